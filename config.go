@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,42 +21,342 @@ const (
 	ActionAllow SecurityAction = iota
 	ActionBlock
 	ActionAsk
+	// ActionSandbox opens the file with its default application inside a
+	// sandbox without network access; see sandboxCommand.
+	ActionSandbox
+	// ActionSnapshot opens a read-only copy of the file; see takeSnapshot.
+	ActionSnapshot
+	// ActionReveal shows the file in the file manager instead of opening it.
+	ActionReveal
+	// ActionCopyPath copies the path to the clipboard instead of opening it.
+	ActionCopyPath
+	// ActionOpenWith opens the file with the application in Verdict.App.
+	ActionOpenWith
+	// ActionAskAlways asks like ActionAsk, but the answer is never
+	// remembered, so the dialog comes back every time.
+	ActionAskAlways
 )
 
+var actionStrings = map[SecurityAction]string{
+	ActionAllow:     "allow",
+	ActionBlock:     "block",
+	ActionAsk:       "ask",
+	ActionSandbox:   "sandbox",
+	ActionSnapshot:  "snapshot",
+	ActionReveal:    "reveal",
+	ActionCopyPath:  "copy-path",
+	ActionOpenWith:  "open-with",
+	ActionAskAlways: "ask-always",
+}
+
+func (a SecurityAction) String() string {
+	if s, ok := actionStrings[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("SecurityAction(%d)", int(a))
+}
+
+func (a SecurityAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// opens reports whether the action launches an application on the file.
+// Reveal and copy-path only point at it.
+func (a SecurityAction) opens() bool {
+	return a != ActionBlock && a != ActionReveal && a != ActionCopyPath
+}
+
+// originPrefix marks list entries that match the download origin host
+// instead of the file name, e.g. "origin:*.example.com".
+const originPrefix = "origin:"
+
+// Verdict is the outcome of a security check.
+type Verdict struct {
+	Action SecurityAction
+	// Rule describes the entry that decided the action, e.g.
+	// "blocked: *.exe" or "rule: ask if size > 500MB".
+	Rule string
+	// Target is the path with all symlinks resolved. It equals the checked
+	// path when no links are involved.
+	Target string
+	// Origin is the download origin recorded on the file, or nil.
+	Origin *Origin
+	// App is the application of an open-with rule.
+	App string
+	// Then is what happens once an ActionAsk verdict is confirmed:
+	// ActionAllow, or the action that warnings or the download origin
+	// turned into ActionAsk.
+	Then SecurityAction
+	// Warnings explains why a file name looks deceptive. A verdict with
+	// warnings never opens the file without asking.
+	Warnings []string
+}
+
 // Config holds the application configuration.
 type Config struct {
 	Blocked []string `yaml:"blocked"`
 	Allowed []string `yaml:"allowed"`
+	Rules   []Rule   `yaml:"rules,omitempty"`
 	Silent  bool     `yaml:"silent"`
+	// Mode is "normal" (the default) or "kiosk"; see modeKiosk.
+	Mode string `yaml:"mode,omitempty"`
+	// BlockedHashes are files listing SHA-256 digests of known-bad files;
+	// see loadHashList.
+	BlockedHashes []string `yaml:"blocked_hashes,omitempty"`
+	// SnapshotRetention is how long snapshots are kept; see takeSnapshot.
+	SnapshotRetention time.Duration `yaml:"snapshot_retention,omitempty"`
+	// Scanner is a malware scanner run before opening files; see Scanner.
+	Scanner *Scanner `yaml:"scanner,omitempty"`
+	// Env controls the environment applications are opened with; see
+	// EnvConfig.
+	Env *EnvConfig `yaml:"env,omitempty"`
+	// Debug writes details such as environment changes to the debug log;
+	// see debugf.
+	Debug bool `yaml:"debug,omitempty"`
+	// Roots are the only directories kiosk mode opens anything in. Unlike
+	// blocked and allowed, a later layer replaces the list.
+	Roots []string `yaml:"roots,omitempty"`
+	// When holds settings that only apply on some machines; see WhenBlock.
+	When []WhenBlock `yaml:"when,omitempty"`
+	// Include lists config files to load before this one; see loadLayer.
+	Include []string `yaml:"include,omitempty"`
+
+	// policyBlocked are the signed policy bundle's blocked entries. They are
+	// checked before everything else, so that no negation in a user layer
+	// can take them back.
+	policyBlocked []string
+	// defaultBlocked is set while Blocked still holds the built-in list, so
+	// that the first layer setting blocked replaces it instead of appending.
+	defaultBlocked bool
+	// DefaultsVersion records which built-in blocklist entries the config
+	// has already received; see mergeDefaults.
+	DefaultsVersion int `yaml:"defaults_version"`
+}
+
+// defaultsVersion is the current version of builtinBlocked. Bump it whenever
+// entries are added, and tag the new entries with it.
+const defaultsVersion = 2
+
+// builtinBlocked is the built-in blocklist. Since is the defaults version
+// that introduced an entry; OS limits an entry to one platform.
+var builtinBlocked = []struct {
+	Pattern string
+	OS      string
+	Since   int
+}{
+	// Windows executables and scripts, blocked everywhere since they also
+	// run under Wine or get passed on to other machines.
+	{"*.exe", "", 1}, {"*.bat", "", 1}, {"*.cmd", "", 1}, {"*.ps1", "", 1},
+	{"*.vbs", "", 1}, {"*.js", "", 1}, {"*.msi", "", 1}, {"*.scr", "", 1},
+	{"*.com", "", 1}, {"*.pif", "", 1}, {"*.reg", "", 1}, {"*.wsf", "", 1},
+	{"*.wsh", "", 1},
+	{"*.jar", "", 2},
+	{"*.hta", "windows", 2}, {"*.cpl", "windows", 2}, {"*.msc", "windows", 2},
+	{"*.jse", "windows", 2}, {"*.vbe", "windows", 2}, {"*.lnk", "windows", 2},
+
+	// Things xdg-open hands to a launcher, interpreter or package installer.
+	{"*.desktop", "linux", 2}, {"*.sh", "linux", 2}, {"*.appimage", "linux", 2},
+	{"*.run", "linux", 2}, {"*.py", "linux", 2}, {"*.deb", "linux", 2},
+	{"*.rpm", "linux", 2}, {"*.flatpakref", "linux", 2}, {"*.flatpak", "linux", 2},
+	{"*.snap", "linux", 2},
+
+	// Things Finder launches or installs.
+	{"*.app", "darwin", 2}, {"*.command", "darwin", 2}, {"*.pkg", "darwin", 2},
+	{"*.mpkg", "darwin", 2}, {"*.terminal", "darwin", 2}, {"*.workflow", "darwin", 2},
 }
 
 // DefaultConfig returns a config with sensible defaults.
 func DefaultConfig() *Config {
-	return &Config{
-		Blocked: []string{
-			"*.exe", "*.bat", "*.cmd", "*.ps1", "*.vbs", "*.js", "*.msi",
-			"*.scr", "*.com", "*.pif", "*.reg", "*.wsf", "*.wsh",
-		},
-		Allowed: []string{},
+	cfg := &Config{
+		Blocked:         []string{},
+		Allowed:         []string{},
+		DefaultsVersion: defaultsVersion,
 	}
+	for _, d := range builtinBlocked {
+		if d.OS == "" || d.OS == runtime.GOOS {
+			cfg.Blocked = append(cfg.Blocked, d.Pattern)
+		}
+	}
+	return cfg
 }
 
+// mergeDefaults adds the built-in blocklist entries for goos that were
+// introduced after the config's DefaultsVersion, then records the current
+// version. Entries the user already lists as blocked or allowed, or takes
+// back with "!", are left alone. Configs written before versioning count as version 1.
+func (c *Config) mergeDefaults(goos string) {
+	seen := max(c.DefaultsVersion, 1)
+	for _, d := range builtinBlocked {
+		if d.Since <= seen || (d.OS != "" && d.OS != goos) {
+			continue
+		}
+		if mentionsFold(c.Blocked, d.Pattern) || mentionsFold(c.Allowed, d.Pattern) {
+			continue
+		}
+		c.Blocked = append(c.Blocked, d.Pattern)
+	}
+	c.DefaultsVersion = defaultsVersion
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionsFold is containsFold for entries with any "!" negation removed.
+func mentionsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(item string) bool {
+		pattern, _ := cutNegation(item)
+		return strings.EqualFold(pattern, s)
+	})
+}
+
+// configFlag is the config path given with --config, if any.
+var configFlag string
+
 // ConfigPath returns the path to the config file.
 func ConfigPath() (string, error) {
+	path, _, err := resolveConfigPath()
+	return path, err
+}
+
+// resolveConfigPath picks the config file and says where the choice came
+// from. In order of precedence:
+//  1. --config
+//  2. $OPE_CONFIG
+//  3. portable mode: ope.yml next to the executable, if it exists
+//  4. ope/ope.yml in the user config directory
+func resolveConfigPath() (path, source string, err error) {
+	if configFlag != "" {
+		path, err = filepath.Abs(expandHome(configFlag))
+		return path, "--config", err
+	}
+	if env := os.Getenv("OPE_CONFIG"); env != "" {
+		path, err = filepath.Abs(expandHome(env))
+		return path, "OPE_CONFIG", err
+	}
+	if path := portableConfigPath(); path != "" {
+		return path, "portable", nil
+	}
 	dir, err := os.UserConfigDir()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	return filepath.Join(dir, "ope", "ope.yml"), "user", nil
+}
+
+// portableConfigPath returns the ope.yml next to the executable, or "" if
+// there is none.
+func portableConfigPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	path := filepath.Join(filepath.Dir(exe), "ope.yml")
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return ""
+	}
+	return path
+}
+
+// envSettings are the settings that can be overridden with environment
+// variables, named OPE_ followed by the upper-cased key, e.g. OPE_SILENT=true.
+// Values use YAML syntax and are applied on top of everything else.
+var envSettings = []string{"silent", "debug"}
+
+// applyEnv applies OPE_* overrides from getenv.
+func (c *Config) applyEnv(getenv func(string) (string, bool)) error {
+	for _, key := range envSettings {
+		name := "OPE_" + strings.ToUpper(key)
+		value, ok := getenv(name)
+		if !ok {
+			continue
+		}
+		node := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: key},
+			{Kind: yaml.ScalarNode, Value: value},
+		}}
+		if err := c.overlay(node); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
-	return filepath.Join(dir, "ope", "ope.yml"), nil
+	return nil
 }
 
-// LoadConfig reads the config from disk, or returns default config if not found.
+// LoadConfig reads the config from disk, or returns default config if not
+// found. It then applies the when blocks matching this machine, OPE_*
+// environment overrides, the decisions learned from dialogs and the signed
+// policy bundle, if the system config names one.
 func LoadConfig() (*Config, error) {
+	return loadConfig(true)
+}
+
+// loadConfig is LoadConfig, with the learned decisions left out unless
+// decisions is set.
+func loadConfig(decisions bool) (*Config, error) {
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyWhen(currentMachine()); err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	// Learned decisions go in before the system policy, so that the
+	// policy's entries come after them and win. Kiosk mode ignores them.
+	kiosk := cfg.kiosk()
+	if decisions && !kiosk {
+		d, err := LoadDecisions()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Blocked = append(cfg.Blocked, d.Blocked...)
+		cfg.Allowed = append(cfg.Allowed, d.Allowed...)
+	}
+	if err := cfg.applySystemPolicy(); err != nil {
+		return nil, err
+	}
+	if decisions && cfg.kiosk() && !kiosk {
+		// The policy turned kiosk mode on: start over without the decisions.
+		return loadConfig(false)
+	}
+	if err := cfg.checkMode(); err != nil {
+		return nil, err
+	}
+	if cfg.Scanner != nil {
+		if err := cfg.Scanner.check(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Env != nil {
+		if err := cfg.Env.check(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// loadConfigFile reads the config file and everything it includes, without
+// when blocks applied or learned decisions merged.
+func loadConfigFile() (*Config, error) {
 	path, err := ConfigPath()
 	if err != nil {
 		return DefaultConfig(), nil
 	}
 
+	if err := checkFilePerms(path, false); err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -60,12 +366,134 @@ func LoadConfig() (*Config, error) {
 	}
 
 	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	cfg.DefaultsVersion = 0
+	cfg.defaultBlocked = true
+	if err := cfg.loadLayer(path, data, nil); err != nil {
 		return nil, err
 	}
+	cfg.defaultBlocked = false
+	cfg.mergeDefaults(runtime.GOOS)
 	return cfg, nil
 }
 
+// addConfigEntry appends entry to the blocked or allowed list (key) of the
+// config file, creating the file or the list if needed. The file is edited
+// as a YAML document, so comments, includes and other settings stay as they
+// are and nothing else, such as the built-in blocklist, is written into a
+// file that may be shared between machines.
+func addConfigEntry(key, entry string) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: not a mapping", path)
+	}
+
+	var list *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			list = root.Content[i+1]
+		}
+	}
+	switch {
+	case list == nil:
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+		if key == "blocked" {
+			// A file without blocked entries gets the built-in list; the
+			// first one it lists replaces that. Keep the entries every
+			// platform shares, mergeDefaults adds the rest when loading.
+			for _, d := range builtinBlocked {
+				if d.Since <= 1 && d.OS == "" {
+					list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: d.Pattern})
+				}
+			}
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, list)
+	case list.Kind == yaml.ScalarNode && list.Tag == "!!null":
+		// "allowed:" with nothing after it.
+		list.Kind, list.Tag, list.Value = yaml.SequenceNode, "", ""
+	case list.Kind != yaml.SequenceNode:
+		return fmt.Errorf("%s: %s is not a list", path, key)
+	}
+	if slices.ContainsFunc(list.Content, func(n *yaml.Node) bool { return n.Value == entry }) {
+		return nil
+	}
+	list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: entry})
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o600)
+}
+
+// overlay applies a partial config on top of c: settings present in node
+// replace c's, lists are appended to c's with duplicates dropped. The scanner
+// and env blocks are replaced as a whole, so that nothing of an earlier
+// layer's, such as on_error: open, carries over into a later one's.
+func (c *Config) overlay(node *yaml.Node) error {
+	if node.Kind == 0 {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "scanner":
+			c.Scanner = nil
+		case "env":
+			c.Env = nil
+		}
+	}
+	blocked, allowed, rules, when, include := c.Blocked, c.Allowed, c.Rules, c.When, c.Include
+	hashes := c.BlockedHashes
+	c.Blocked, c.Allowed, c.Rules, c.When, c.BlockedHashes = nil, nil, nil, nil, nil
+	err := node.Decode(c)
+
+	if c.Blocked != nil && c.defaultBlocked {
+		blocked, c.defaultBlocked = nil, false
+	}
+	c.Blocked = appendNew(blocked, c.Blocked...)
+	c.Allowed = appendNew(allowed, c.Allowed...)
+	c.BlockedHashes = appendNew(hashes, c.BlockedHashes...)
+	for _, rule := range c.Rules {
+		if !slices.ContainsFunc(rules, func(r Rule) bool { return r.Source == rule.Source }) {
+			rules = append(rules, rule)
+		}
+	}
+	c.Rules = rules
+	c.When = append(when, c.When...)
+	c.Include = include
+	return err
+}
+
+// appendNew appends the items not already in list.
+func appendNew(list []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // SaveConfig writes the config to disk.
 func SaveConfig(cfg *Config) error {
 	path, err := ConfigPath()
@@ -73,7 +501,7 @@ func SaveConfig(cfg *Config) error {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return err
 	}
 
@@ -81,30 +509,317 @@ func SaveConfig(cfg *Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	return os.WriteFile(path, data, 0o600)
 }
 
 // CheckSecurity determines the security action for a given path.
-func (c *Config) CheckSecurity(path string) SecurityAction {
-	base := strings.ToLower(filepath.Base(path))
+// The checks run in order and the first one that applies wins:
+//  0. deceptive names (see checkFileName): disguised executables and bidi
+//     overrides block, other suspicious names turn any allow into ask
+//  1. blocked entries, against the path and every symlink hop to the target;
+//     a matching reveal or copy-path rule in the config replaces the block
+//  2. rules, in the order they are listed, then those of .ope.yml files
+//     (see LocalPolicy)
+//  3. download origin: files from the internet ask unless the origin is
+//     allowed, and so do rules in step 2 that would open them
+//  4. allowed entries
+//  5. directories are allowed, anything else asks
+//
+// Everything after step 1 looks at the final symlink target only. Blocked
+// and allowed entries are base name globs or path patterns; see matchList.
+func (c *Config) CheckSecurity(path string) Verdict {
+	return c.checkPinned(path, nil)
+}
+
+// checkPinned is CheckSecurity for a path that has already been opened with
+// pinFile. Content checks read from the pinned handle instead of reopening
+// the path; pin may be nil.
+func (c *Config) checkPinned(path string, pin *pinnedFile) Verdict {
+	chain := symlinkChain(path)
+	target := chain[len(chain)-1]
+	v := Verdict{Target: target, Origin: readOrigin(target, pin)}
+
+	// originAllowed reports whether an allowed origin: entry matches; it is
+	// set once the allowed lists are known.
+	originAllowed := func() bool { return false }
+
+	decide := func(action SecurityAction, rule string) Verdict {
+		// Opening a file with warnings or from the internet always asks
+		// first; Then keeps what happens after the dialog.
+		ask := func(why string) {
+			if action.opens() && action != ActionAsk && action != ActionAskAlways {
+				v.Then, action = action, ActionAsk
+				rule += " (asking: " + why + ")"
+			}
+		}
+		if len(v.Warnings) > 0 {
+			ask("deceptive name")
+		}
+		if v.Origin != nil && !originAllowed() {
+			ask("downloaded from " + v.Origin.Source())
+		}
+		if (action == ActionAsk || action == ActionAskAlways) && c.kiosk() {
+			action = ActionBlock
+			rule = "kiosk: " + rule
+		}
+		v.Action, v.Rule = action, rule
+		return v
+	}
+
+	// What gets opened is the target, so that is what has to be under the
+	// roots, however the path got there.
+	if c.kiosk() && !c.underRoots(target) {
+		return decide(ActionBlock, "kiosk: outside roots")
+	}
+
+	for _, hop := range chain {
+		for _, w := range checkFileName(filepath.Base(hop)) {
+			if w.block {
+				return decide(ActionBlock, "deceptive name: "+w.message)
+			}
+			if !slices.Contains(v.Warnings, w.message) {
+				v.Warnings = append(v.Warnings, w.message)
+			}
+		}
+	}
+
+	file := candidate{
+		path:   target,
+		origin: v.Origin,
+		isDir:  isDirFunc(target),
+		sum:    sync.OnceValue(func() string { return fileHash(target, pin) }),
+	}
+	if pin != nil {
+		file.isDir = pin.info.IsDir
+	}
+
+	// Per-directory .ope.yml files, except in kiosk mode where the config
+	// alone decides. Each list is checked on its own, so that nothing in
+	// them can take back a match in the user's blocked list.
+	localPolicies := func(hop string) []*LocalPolicy {
+		if c.kiosk() {
+			return nil
+		}
+		policies, _ := findLocalPolicies(hop)
+		return policies
+	}
+	local := localPolicies(target)
+
+	// Allowed lists are checked together, nearest last, and the last one
+	// with a matching entry decides.
+	allowedFile := file
+	allowedFile.named = true
+	allowed := func(skip func(string) bool) string {
+		decided, _ := matchList(slices.DeleteFunc(slices.Clone(c.Allowed), skip), "", allowedFile)
+		if decided != "" {
+			decided = "allowed: " + decided
+		}
+		for _, lp := range local {
+			if pattern, hit := matchList(slices.DeleteFunc(slices.Clone(lp.Allowed), skip), lp.dir(), allowedFile); hit {
+				decided = ""
+				if pattern != "" {
+					decided = "allowed: " + pattern + lp.source()
+				}
+			}
+		}
+		return decided
+	}
+	originRule := sync.OnceValue(func() string {
+		return allowed(func(e string) bool { return !isOriginEntry(e) })
+	})
+	originAllowed = func() bool { return originRule() != "" }
+
+	// A reveal or copy-path rule in the config still applies to a file that
+	// a blocked entry matched: nothing is opened either way.
+	block := func(rule string) Verdict {
+		if len(c.Rules) > 0 {
+			facts := newFileFacts(target, v.Origin, pin)
+			for _, r := range c.Rules {
+				if !r.Action.opens() && r.Action != ActionBlock && r.Matches(facts) {
+					return decide(r.Action, "rule: "+r.Source+" ("+rule+")")
+				}
+			}
+		}
+		return decide(ActionBlock, rule)
+	}
+
+	for _, hop := range chain {
+		hopFile, hopLocal := file, local
+		if hop != target {
+			hopFile = candidate{path: hop, origin: v.Origin, isDir: isDirFunc(hop)}
+			hopLocal = localPolicies(hop)
+		}
+		via := ""
+		if hop != path {
+			via = " (via symlink to " + visibleName(hop) + ")"
+		}
+		if pattern, _ := matchList(c.policyBlocked, "", hopFile); pattern != "" {
+			return block("blocked: " + pattern + " (from policy)" + via)
+		}
+		if pattern, _ := matchList(c.Blocked, "", hopFile); pattern != "" {
+			return block("blocked: " + pattern + via)
+		}
+		for _, lp := range hopLocal {
+			if lp.err != nil {
+				return decide(ActionBlock, "unreadable local policy: "+lp.err.Error())
+			}
+			if pattern, _ := matchList(lp.Blocked, lp.dir(), hopFile); pattern != "" {
+				return block("blocked: " + pattern + lp.source() + via)
+			}
+		}
+	}
 
-	for _, pattern := range c.Blocked {
-		if matched, _ := filepath.Match(strings.ToLower(pattern), base); matched {
-			return ActionBlock
+	if len(c.BlockedHashes) > 0 {
+		if sum := file.sum(); sum != "" {
+			if rule := c.checkHashLists(sum); rule != "" {
+				return decide(ActionBlock, rule)
+			}
 		}
 	}
 
-	for _, pattern := range c.Allowed {
-		if matched, _ := filepath.Match(strings.ToLower(pattern), base); matched {
-			return ActionAllow
+	if len(c.Rules) > 0 || len(local) > 0 {
+		facts := newFileFacts(target, v.Origin, pin)
+		for _, rule := range c.Rules {
+			if rule.Matches(facts) {
+				v.App = rule.App
+				return decide(rule.Action, "rule: "+rule.Source)
+			}
+		}
+		for _, lp := range local {
+			for _, rule := range lp.Rules {
+				if rule.Matches(facts) {
+					return decide(rule.Action, "rule: "+rule.Source+lp.source())
+				}
+			}
 		}
 	}
 
+	if v.Origin != nil {
+		if rule := originRule(); rule != "" {
+			return decide(ActionAllow, rule)
+		}
+		return decide(ActionAsk, "downloaded from "+v.Origin.Source())
+	}
+
+	if rule := allowed(func(string) bool { return false }); rule != "" {
+		return decide(ActionAllow, rule)
+	}
+
 	// Directories are allowed by default
-	info, err := os.Stat(path)
-	if err == nil && info.IsDir() {
-		return ActionAllow
+	if file.isDir() {
+		return decide(ActionAllow, "default: directory")
 	}
 
-	return ActionAsk
+	return decide(ActionAsk, "default: unknown file")
+}
+
+// maxSymlinkHops bounds symlink resolution, matching the Linux ELOOP limit.
+const maxSymlinkHops = 40
+
+// symlinkChain returns path followed by every symlink hop up to the final
+// target. The last element is always the fully resolved path as reported by
+// filepath.EvalSymlinks, which also resolves links in parent directories.
+// Paths that don't exist resolve to themselves.
+func symlinkChain(path string) []string {
+	chain := []string{path}
+	cur := path
+	for i := 0; i < maxSymlinkHops; i++ {
+		info, err := os.Lstat(cur)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			break
+		}
+		link, err := os.Readlink(cur)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(cur), link)
+		}
+		cur = filepath.Clean(link)
+		chain = append(chain, cur)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if abs, err := filepath.Abs(resolved); err == nil {
+			resolved = abs
+		}
+		last, err := filepath.Abs(chain[len(chain)-1])
+		if err != nil || resolved != last {
+			chain = append(chain, resolved)
+		}
+	}
+	return chain
+}
+
+func isOriginEntry(pattern string) bool {
+	pattern, _ = cutNegation(pattern)
+	return strings.HasPrefix(strings.ToLower(pattern), originPrefix)
+}
+
+// candidate is what blocked and allowed entries are matched against.
+type candidate struct {
+	path   string
+	origin *Origin
+	isDir  func() bool
+	// sum returns the hex SHA-256 of the content, or "" if the file can't
+	// be hashed. It is nil for symlink hops, which have no content.
+	sum func() string
+	// named limits sha256: entries with a note to files of that name, so
+	// that the file is only read when the entry could be about it. It is
+	// set for allowed lists, where "Always Allow" notes the name.
+	named bool
+}
+
+// matchList applies a blocked or allowed list to a file the way .gitignore
+// does: every entry is checked in order and the last match decides, so a
+// "!" entry takes back earlier matches. It returns the entry that made the
+// file match, or "" if it doesn't, and whether any entry matched at all.
+// Path patterns are relative to base, or to no directory if base is empty;
+// see compilePathPattern.
+func matchList(list []string, base string, f candidate) (entry string, hit bool) {
+	for _, e := range list {
+		pattern, negate := cutNegation(e)
+		if !matchPattern(pattern, base, f) {
+			continue
+		}
+		hit = true
+		if negate {
+			entry = ""
+		} else if entry == "" {
+			entry = e
+		}
+	}
+	return entry, hit
+}
+
+// matchPattern matches a single entry, without negation: sha256: entries
+// against the content, path patterns against the full path, origin entries
+// against the origin host and anything else against the base name.
+func matchPattern(pattern, base string, f candidate) bool {
+	switch {
+	case isHashEntry(pattern):
+		want := entryHash(pattern)
+		if note := entryNote(pattern); f.named && note != "" && !strings.EqualFold(note, filepath.Base(f.path)) {
+			return false
+		}
+		return f.sum != nil && want != "" && f.sum() == want
+	case !isOriginEntry(pattern) && isPathPattern(pattern):
+		return compilePathPattern(pattern, base).match(f.path, f.isDir)
+	}
+	return matchEntry(pattern, strings.ToLower(filepath.Base(f.path)), f.origin)
+}
+
+// matchEntry reports whether a blocked/allowed entry matches the lowercased
+// base name, or the origin host for "origin:" entries.
+func matchEntry(pattern, base string, origin *Origin) bool {
+	pattern = strings.ToLower(pattern)
+	if host, ok := strings.CutPrefix(pattern, originPrefix); ok {
+		if origin == nil {
+			return false
+		}
+		matched, _ := filepath.Match(host, origin.Host())
+		return matched
+	}
+	matched, _ := filepath.Match(pattern, base)
+	return matched
 }
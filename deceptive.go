@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// nameWarning is a reason a file name may be disguising what the file is.
+type nameWarning struct {
+	// block is set for tricks with no legitimate use, such as bidi overrides.
+	block   bool
+	message string
+}
+
+// documentExts are extensions an attacker wants a file to appear to have.
+var documentExts = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
+	".ppt": true, ".pptx": true, ".odt": true, ".ods": true, ".txt": true,
+	".rtf": true, ".csv": true, ".html": true, ".htm": true, ".jpg": true,
+	".jpeg": true, ".png": true, ".gif": true, ".mp3": true, ".mp4": true,
+	".zip": true,
+}
+
+// executableExts are extensions that run code when opened.
+var executableExts = map[string]bool{
+	".exe": true, ".scr": true, ".bat": true, ".cmd": true, ".com": true,
+	".pif": true, ".msi": true, ".ps1": true, ".vbs": true, ".js": true,
+	".wsf": true, ".jar": true, ".sh": true, ".py": true, ".desktop": true,
+	".appimage": true, ".run": true, ".app": true, ".command": true,
+}
+
+// scripts are the writing systems checked for mixing within one word.
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Cherokee", unicode.Cherokee},
+}
+
+// isBidiControl reports whether r changes text direction.
+func isBidiControl(r rune) bool {
+	return (r >= 0x202a && r <= 0x202e) || (r >= 0x2066 && r <= 0x2069) ||
+		r == 0x200e || r == 0x200f || r == 0x061c
+}
+
+// isInvisible reports whether r renders as nothing, or as plain whitespace
+// that is easily mistaken for a regular space.
+func isInvisible(r rune) bool {
+	if r == ' ' {
+		return false
+	}
+	return unicode.Is(unicode.Cf, r) || unicode.IsSpace(r) || !unicode.IsPrint(r)
+}
+
+// checkFileName looks for names crafted to look like something else:
+// bidi overrides, invisible characters, padding before the real extension,
+// trailing dots and spaces, document-looking double extensions and letters
+// from several scripts (homoglyphs).
+func checkFileName(name string) []nameWarning {
+	var warnings []nameWarning
+	warn := func(block bool, format string, args ...any) {
+		warnings = append(warnings, nameWarning{block: block, message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.IndexFunc(name, isBidiControl) >= 0 {
+		warn(true, "name contains a text direction override")
+	} else if strings.IndexFunc(name, isInvisible) >= 0 {
+		warn(false, "name contains invisible characters")
+	}
+
+	if trimmed := strings.TrimRight(name, ". "); trimmed != name && trimmed != "" {
+		warn(false, "name ends with dots or spaces")
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	padded := strings.HasSuffix(stem, "  ") || strings.IndexFunc(stem, func(r rune) bool {
+		return r != ' ' && unicode.IsSpace(r)
+	}) >= 0
+	inner := strings.ToLower(filepath.Ext(strings.TrimRightFunc(stem, unicode.IsSpace)))
+	if executableExts[ext] && documentExts[inner] {
+		warn(true, "%s file disguised as %s", ext, inner)
+	} else if padded && ext != "" {
+		warn(false, "whitespace hides the %s extension", ext)
+	}
+
+	// Scripts are compared word by word: отчёт.pdf or "Résumé Αναφορά.docx"
+	// are fine, a Cyrillic а inside pаypal isn't.
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		var seen []string
+		for _, s := range scripts {
+			if strings.IndexFunc(word, func(r rune) bool { return unicode.Is(s.table, r) }) >= 0 {
+				seen = append(seen, s.name)
+			}
+		}
+		if len(seen) > 1 {
+			warn(false, "name mixes %s letters", strings.Join(seen, " and "))
+			break
+		}
+	}
+
+	return warnings
+}
+
+// visibleName renders s with invisible and direction-changing characters
+// replaced by their code points, and trailing spaces made visible, so that
+// dialogs show what the name really is.
+func visibleName(s string) string {
+	trailing := len(s) - len(strings.TrimRight(s, " "))
+	var b strings.Builder
+	for i, r := range s {
+		if isBidiControl(r) || isInvisible(r) || (r == ' ' && i >= len(s)-trailing) {
+			fmt.Fprintf(&b, "[U+%04X]", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckFileName(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantWarn  bool
+		wantBlock bool
+	}{
+		{"report.pdf", false, false},
+		{"archive.tar.gz", false, false},
+		{"my notes.txt", false, false},
+		{"Résumé.pdf", false, false},
+		{"invoice‮fdp.exe", true, true},
+		{"report.pdf.exe", true, true},
+		{"report.pdf          .sh", true, true},
+		{"report          .sh", true, false},
+		{"photo.jpg .png", true, false},
+		{"notes.txt.", true, false},
+		{"notes.txt ", true, false},
+		{"zero​width.txt", true, false},
+		{"pаypal.pdf", true, false}, // Cyrillic а
+		{"отчёт.pdf", false, false},
+		{"Αναφορά.docx", false, false},
+		{"Отчёт за 2024 report.xlsx", false, false},
+		{"Ελληνικά_σημειώσεις.txt", false, false},
+		{"счёт-invoice.pdf", false, false},
+		{"invоice.pdf", true, false}, // Cyrillic о
+	}
+
+	for _, tt := range tests {
+		t.Run(visibleName(tt.name), func(t *testing.T) {
+			warnings := checkFileName(tt.name)
+			block := false
+			for _, w := range warnings {
+				block = block || w.block
+			}
+			if (len(warnings) > 0) != tt.wantWarn || block != tt.wantBlock {
+				t.Errorf("checkFileName(%q) = %+v, want warn=%v block=%v", tt.name, warnings, tt.wantWarn, tt.wantBlock)
+			}
+		})
+	}
+}
+
+func TestVisibleName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"report.pdf", "report.pdf"},
+		{"my notes.txt", "my notes.txt"},
+		{"invoice‮fdp.exe", "invoice[U+202E]fdp.exe"},
+		{"zero​width", "zero[U+200B]width"},
+		{"notes.txt  ", "notes.txt[U+0020][U+0020]"},
+	}
+	for _, tt := range tests {
+		if got := visibleName(tt.in); got != tt.want {
+			t.Errorf("visibleName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSecurityDeceptive(t *testing.T) {
+	cfg := &Config{Allowed: []string{"*.pdf", "*.exe"}}
+
+	if v := cfg.CheckSecurity("/tmp/invoice‮fdp.exe"); v.Action != ActionBlock {
+		t.Errorf("bidi override: got %v, want ActionBlock", v.Action)
+	}
+	v := cfg.CheckSecurity("/tmp/pаypal.pdf")
+	if v.Action != ActionAsk || len(v.Warnings) == 0 {
+		t.Errorf("homoglyph: got %v %v, want ActionAsk with warnings", v.Action, v.Warnings)
+	}
+	if v := cfg.CheckSecurity("/tmp/отчёт.pdf"); v.Action != ActionAllow {
+		t.Errorf("Cyrillic name: got %v %v, want ActionAllow", v.Action, v.Warnings)
+	}
+}
+
+func TestCheckSecurityDeceptiveRules(t *testing.T) {
+	var cfg Config
+	data := `
+rules:
+  - snapshot if ext == ".pdf"
+  - sandbox if ext == ".html"
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every action that opens the file asks first, and carries on after.
+	for name, then := range map[string]SecurityAction{"pаypal.pdf": ActionSnapshot, "pаypal.html": ActionSandbox} {
+		v := cfg.CheckSecurity(filepath.Join(t.TempDir(), name))
+		if v.Action != ActionAsk || v.Then != then || !strings.HasSuffix(v.Rule, "(asking: deceptive name)") {
+			t.Errorf("CheckSecurity(%q) = %v then %v %q, want ask then %v", name, v.Action, v.Then, v.Rule, then)
+		}
+	}
+}
+
+func TestConfirmMessageOrigin(t *testing.T) {
+	v := Verdict{Origin: &Origin{URL: "https://example.com/‮gpj.exe\nDownloaded from: intranet"}}
+	msg := confirmMessage("/tmp/report.pdf", v)
+	if strings.Contains(msg, "‮") || strings.Contains(msg, "\nDownloaded from: intranet") {
+		t.Errorf("origin shown raw: %q", msg)
+	}
+	if !strings.Contains(msg, "[U+202E]") || !strings.Contains(msg, "[U+000A]") {
+		t.Errorf("origin not made visible: %q", msg)
+	}
+}
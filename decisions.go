@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Decisions holds the allow/block entries learned from dialog choices. They
+// live in a state file apart from ope.yml, which may be hand-written and kept
+// in version control, and are merged into the config at load time.
+type Decisions struct {
+	Allowed []string `yaml:"allowed"`
+	Blocked []string `yaml:"blocked"`
+}
+
+// StateDir returns the directory for files ope writes on its own:
+// $XDG_STATE_HOME/ope, ~/.local/state/ope on Linux, and the config
+// directory elsewhere. In portable mode it is the executable's directory.
+func StateDir() (string, error) {
+	if path := portableConfigPath(); path != "" {
+		return filepath.Dir(path), nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "ope"), nil
+	}
+	if runtime.GOOS == "linux" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "state", "ope"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ope"), nil
+}
+
+// DecisionsPath returns the path to the learned decisions file.
+func DecisionsPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "decisions.yml"), nil
+}
+
+// LoadDecisions reads the learned decisions, or returns none if the file
+// doesn't exist.
+func LoadDecisions() (*Decisions, error) {
+	d := &Decisions{}
+	path, err := DecisionsPath()
+	if err != nil {
+		return d, nil
+	}
+
+	if err := checkFilePerms(path, false); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Dialogs only ever add entries; a negation would take back one from
+	// the config or the system policy instead.
+	for _, entry := range slices.Concat(d.Blocked, d.Allowed) {
+		if _, negated := cutNegation(entry); negated {
+			return nil, fmt.Errorf("%s: negated entry %q: decisions can't take back other entries", path, entry)
+		}
+	}
+	return d, nil
+}
+
+// SaveDecisions writes the learned decisions to disk.
+func SaveDecisions(d *Decisions) error {
+	path, err := DecisionsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// RecordDecision remembers a dialog choice for pattern. A leading "!", as in
+// a file named "!notes.txt", is escaped so it isn't read as a negation.
+func RecordDecision(allow bool, pattern string) error {
+	d, err := LoadDecisions()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(pattern, "!") {
+		pattern = `\` + pattern
+	}
+	list := &d.Blocked
+	if allow {
+		list = &d.Allowed
+	}
+	if !slices.Contains(*list, pattern) {
+		*list = append(*list, pattern)
+	}
+	return SaveDecisions(d)
+}
+
+// remove deletes pattern from the decisions and reports which list held it.
+func (d *Decisions) remove(pattern string) (allowed, found bool) {
+	if i := slices.Index(d.Allowed, pattern); i >= 0 {
+		d.Allowed = slices.Delete(d.Allowed, i, i+1)
+		return true, true
+	}
+	if i := slices.Index(d.Blocked, pattern); i >= 0 {
+		d.Blocked = slices.Delete(d.Blocked, i, i+1)
+		return false, true
+	}
+	return false, false
+}
+
+// runDecisions implements `ope decisions list|promote|forget`.
+func runDecisions(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ope decisions list|promote <entry>|forget <entry>")
+	}
+
+	d, err := LoadDecisions()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		path, _ := DecisionsPath()
+		fmt.Printf("Decisions: %s\n", path)
+		fmt.Printf("Blocked: %v\n", d.Blocked)
+		fmt.Printf("Allowed: %v\n", d.Allowed)
+		return nil
+
+	case "promote", "forget":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: ope decisions %s <entry>", args[0])
+		}
+		pattern := args[1]
+		allowed, found := d.remove(pattern)
+		if !found {
+			return fmt.Errorf("no learned decision for %q", pattern)
+		}
+
+		if args[0] == "promote" {
+			if full, err := LoadConfig(); err == nil && full.kiosk() {
+				return fmt.Errorf("promote: %w", errKiosk)
+			}
+			// Promote into the hand-written config file only, without the
+			// includes and learned decisions that LoadConfig would merge in.
+			key := "blocked"
+			if allowed {
+				key = "allowed"
+			}
+			if err := addConfigEntry(key, pattern); err != nil {
+				return err
+			}
+		}
+
+		if err := SaveDecisions(d); err != nil {
+			return err
+		}
+		if args[0] == "promote" {
+			fmt.Printf("Promoted %s to config\n", pattern)
+		} else {
+			fmt.Printf("Forgot %s\n", pattern)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown decisions command: %s", args[0])
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+// confirmMessage builds the text shown in the confirmation dialog. Names are
+// passed through visibleName so that invisible characters can't disguise them.
+func confirmMessage(path string, v Verdict) string {
+	msg := "Open this path?\n\n" + visibleName(path)
+	if v.Target != "" && v.Target != path {
+		msg += "\n→ " + visibleName(v.Target)
+	}
+	for _, w := range v.Warnings {
+		msg += "\n\n⚠ Warning: " + w
+	}
+	if v.Origin != nil {
+		msg += "\n\nDownloaded from: " + v.Origin.Source()
+	}
+	return msg
+}
@@ -22,10 +22,14 @@ func showErrorDialog(title, message string) {
 	_ = exec.Command("osascript", "-e", script).Run()
 }
 
-func showConfirmDialog(path string) ConfirmResult {
-	script := `display dialog "Open this path?\n\n` + escapeAS(path) + `" ` +
+func showConfirmDialog(message string, remember bool) ConfirmResult {
+	buttons := `{"Block", "Always Allow", "Allow Once"}`
+	if !remember {
+		buttons = `{"Block", "Allow Once"}`
+	}
+	script := `display dialog "` + escapeAS(message) + `" ` +
 		`with title "ope — Confirm" ` +
-		`buttons {"Block", "Always Allow", "Allow Once"} ` +
+		`buttons ` + buttons + ` ` +
 		`default button "Allow Once" ` +
 		`with icon caution`
 	out, err := exec.Command("osascript", "-e", script).Output()
@@ -24,16 +24,18 @@ func showErrorDialog(title, message string) {
 	}
 }
 
-func showConfirmDialog(path string) ConfirmResult {
+func showConfirmDialog(message string, remember bool) ConfirmResult {
 	// Use zenity --list for a 3-option dialog
-	out, err := exec.Command("zenity", "--list",
+	args := []string{"--list",
 		"--title=ope — Confirm",
-		"--text=Open this path?\n\n"+path,
+		"--text=" + message,
 		"--column=Action",
 		"Allow Once",
-		"Always Allow",
-		"Block",
-	).Output()
+	}
+	if remember {
+		args = append(args, "Always Allow")
+	}
+	out, err := exec.Command("zenity", append(args, "Block")...).Output()
 	if err != nil {
 		return ConfirmCancel
 	}
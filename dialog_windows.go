@@ -22,7 +22,11 @@ func showErrorDialog(title, message string) {
 	_ = exec.Command("powershell", "-NoProfile", "-Command", ps).Run()
 }
 
-func showConfirmDialog(path string) ConfirmResult {
+func showConfirmDialog(message string, remember bool) ConfirmResult {
+	always := "$true"
+	if !remember {
+		always = "$false"
+	}
 	// PowerShell script that shows a custom form with 3 buttons
 	ps := `Add-Type -AssemblyName System.Windows.Forms
 $form = New-Object System.Windows.Forms.Form
@@ -34,7 +38,7 @@ $form.FormBorderStyle = "FixedDialog"
 $form.MaximizeBox = $false
 
 $label = New-Object System.Windows.Forms.Label
-$label.Text = "Open this path?` + "\n\n" + escapePSStr(path) + `"
+$label.Text = "` + escapePSStr(message) + `"
 $label.AutoSize = $true
 $label.Location = New-Object System.Drawing.Point(20, 20)
 $form.Controls.Add($label)
@@ -49,6 +53,7 @@ $btnAlways = New-Object System.Windows.Forms.Button
 $btnAlways.Text = "Always Allow"
 $btnAlways.Location = New-Object System.Drawing.Point(200, 120)
 $btnAlways.Add_Click({ $form.Tag = "always"; $form.Close() })
+$btnAlways.Visible = ` + always + `
 $form.Controls.Add($btnAlways)
 
 $btnBlock = New-Object System.Windows.Forms.Button
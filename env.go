@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// EnvConfig controls the environment of the processes that open files.
+type EnvConfig struct {
+	// Mode is "login" (the default), "clean" or "inherit"; see envLogin.
+	Mode string `yaml:"mode,omitempty"`
+	// Strip are more variables to remove, in addition to defaultStripEnv.
+	Strip []string `yaml:"strip,omitempty"`
+	// Keep are variables passed on as they are, even if Strip, the defaults
+	// or the login environment would change them.
+	Keep []string `yaml:"keep,omitempty"`
+	// Set are variables to set on top of everything else.
+	Set map[string]string `yaml:"set,omitempty"`
+}
+
+// Modes for env.mode.
+const (
+	// envLogin strips the variables that break applications and then takes
+	// the login session's values (see loginEnv) for anything missing and
+	// for the variables in restoreEnv.
+	envLogin = "login"
+	// envClean only strips.
+	envClean = "clean"
+	// envInherit passes ope's environment on unchanged.
+	envInherit = "inherit"
+)
+
+// defaultStripEnv are variables that make applications load code or data
+// from somewhere else than where they were installed. Browsers packaged as
+// a Snap, Flatpak or AppImage set them for themselves, and an application
+// started with them crashes or ends up inside the browser's confinement.
+// Entries are globs.
+var defaultStripEnv = []string{
+	"LD_PRELOAD", "LD_LIBRARY_PATH", "LD_AUDIT", "DYLD_*",
+	"GTK_PATH", "GTK_EXE_PREFIX", "GTK_DATA_PREFIX", "GTK_IM_MODULE_FILE",
+	"GIO_MODULE_DIR", "GIO_EXTRA_MODULES", "GIO_LAUNCHED_DESKTOP_FILE*",
+	"GDK_PIXBUF_MODULE_FILE", "GDK_PIXBUF_MODULEDIR", "GSETTINGS_SCHEMA_DIR",
+	"GST_PLUGIN_*", "GST_REGISTRY*", "QT_PLUGIN_PATH", "QT_QPA_PLATFORM_PLUGIN_PATH",
+	"LOCPATH", "GCONV_PATH", "PYTHONPATH", "PYTHONHOME",
+	"SNAP", "SNAP_*", "FLATPAK_*", "APPIMAGE", "APPDIR", "ARGV0", "OWD",
+	"BAMF_DESKTOP_FILE_HINT",
+}
+
+// restoreEnv are variables that confinement rewrites instead of adding, so
+// the login session's value replaces ours.
+var restoreEnv = []string{"PATH", "XDG_DATA_DIRS", "XDG_CONFIG_DIRS"}
+
+// check rejects an unknown mode.
+func (e *EnvConfig) check() error {
+	switch e.Mode {
+	case "", envLogin, envClean, envInherit:
+		return nil
+	default:
+		return fmt.Errorf("env: unknown mode %q (want %s, %s or %s)", e.Mode, envLogin, envClean, envInherit)
+	}
+}
+
+func (e *EnvConfig) mode() string {
+	if e == nil || e.Mode == "" {
+		return envLogin
+	}
+	return e.Mode
+}
+
+// sanitize returns environ, a list of KEY=value strings, without the
+// stripped variables and with login and Set applied. It also returns the
+// changes, sorted by name, as "-KEY=old" and "+KEY=new" lines. A nil
+// EnvConfig means the defaults.
+func (e *EnvConfig) sanitize(environ []string, login map[string]string) (env, diff []string) {
+	var cfg EnvConfig
+	if e != nil {
+		cfg = *e
+	}
+	matches := func(patterns []string, key string) bool {
+		return slices.ContainsFunc(patterns, func(p string) bool {
+			ok, _ := path.Match(p, key)
+			return ok
+		})
+	}
+
+	old := map[string]string{}
+	vars := map[string]string{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			continue
+		}
+		old[key] = value
+		if matches(cfg.Keep, key) || !(matches(defaultStripEnv, key) || matches(cfg.Strip, key)) {
+			vars[key] = value
+		}
+	}
+	for key, value := range login {
+		if matches(cfg.Keep, key) {
+			continue
+		}
+		if _, ok := vars[key]; !ok || slices.Contains(restoreEnv, key) {
+			vars[key] = value
+		}
+	}
+	for key, value := range cfg.Set {
+		vars[key] = value
+	}
+
+	keys := make([]string, 0, len(vars)+len(old))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range vars {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value, kept := vars[key]
+		if kept {
+			env = append(env, key+"="+value)
+		}
+		if was, ok := old[key]; ok && (!kept || was != value) {
+			diff = append(diff, "-"+key+"="+was)
+		}
+		if was, ok := old[key]; kept && (!ok || was != value) {
+			diff = append(diff, "+"+key+"="+value)
+		}
+	}
+	return env, diff
+}
+
+// environment returns the environment for processes that open files and
+// how it differs from ope's own. The environment is nil, meaning ope's,
+// in inherit mode.
+func (c *Config) environment() (env, diff []string) {
+	mode := c.Env.mode()
+	if mode == envInherit {
+		return nil, nil
+	}
+	var login map[string]string
+	if mode == envLogin {
+		var err error
+		if login, err = loginEnv(); err != nil {
+			c.debugf("no login environment: %v", err)
+		}
+	}
+	return c.Env.sanitize(os.Environ(), login)
+}
+
+// openerEnv is environment, with the changes written to the debug log.
+func (c *Config) openerEnv() []string {
+	env, diff := c.environment()
+	for _, line := range diff {
+		c.debugf("env %s", line)
+	}
+	return env
+}
@@ -0,0 +1,9 @@
+//go:build darwin
+
+package main
+
+// loginEnv returns nothing on macOS, where applications started by ope
+// inherit launchd's environment through open anyway.
+func loginEnv() (map[string]string, error) {
+	return nil, nil
+}
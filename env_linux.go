@@ -0,0 +1,50 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// loginEnv returns the environment of the user's login session, as the
+// systemd user manager has it.
+func loginEnv() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "systemctl", "--user", "show-environment")
+	// systemctl itself mustn't run with what this is meant to get rid of;
+	// it only needs to find the user bus.
+	cmd.Env = []string{}
+	for _, key := range []string{"PATH", "HOME", "XDG_RUNTIME_DIR", "DBUS_SESSION_BUS_ADDRESS"} {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseShowEnvironment(strings.NewReader(string(out))), nil
+}
+
+// parseShowEnvironment reads systemctl show-environment output. Values
+// with special characters come in $'...' shell quoting; those variables
+// are left out rather than unquoted.
+func parseShowEnvironment(r io.Reader) map[string]string {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key == "" || strings.HasPrefix(value, "$'") {
+			continue
+		}
+		env[key] = value
+	}
+	return env
+}
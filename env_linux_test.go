@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseShowEnvironment(t *testing.T) {
+	out := "HOME=/home/me\nLANG=en_US.UTF-8\nPS1=$'\\\\u@\\\\h '\nPATH=/usr/bin:/bin\n\nbroken\n"
+	got := parseShowEnvironment(strings.NewReader(out))
+	want := map[string]string{"HOME": "/home/me", "LANG": "en_US.UTF-8", "PATH": "/usr/bin:/bin"}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseShowEnvironment = %v, want %v", got, want)
+	}
+}
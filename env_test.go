@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSanitizeEnv(t *testing.T) {
+	environ := []string{
+		"HOME=/home/me",
+		"PATH=/snap/bin:/usr/bin",
+		"LD_PRELOAD=/snap/firefox/lib/libhook.so",
+		"GTK_PATH=/snap/firefox/usr/lib/gtk-3.0",
+		"SNAP_NAME=firefox",
+		"SNAP=/snap/firefox/42",
+		"FLATPAK_ID=org.mozilla.firefox",
+		"PYTHONPATH=/opt/lib",
+		"EDITOR=vim",
+	}
+	login := map[string]string{
+		"PATH":                     "/usr/local/bin:/usr/bin",
+		"DBUS_SESSION_BUS_ADDRESS": "unix:path=/run/user/1000/bus",
+		"EDITOR":                   "nano",
+		"PYTHONPATH":               "/opt/lib",
+	}
+
+	var cfg EnvConfig
+	data := `
+strip: ["EDITOR"]
+keep: ["SNAP_NAME"]
+set: {MOZ_ENABLE_WAYLAND: "1"}
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	env, diff := cfg.sanitize(environ, login)
+	want := []string{
+		"DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/1000/bus",
+		"EDITOR=nano",
+		"HOME=/home/me",
+		"MOZ_ENABLE_WAYLAND=1",
+		"PATH=/usr/local/bin:/usr/bin",
+		"PYTHONPATH=/opt/lib",
+		"SNAP_NAME=firefox",
+	}
+	if !slices.Equal(env, want) {
+		t.Errorf("env =\n%s\nwant\n%s", strings.Join(env, "\n"), strings.Join(want, "\n"))
+	}
+	wantDiff := []string{
+		"+DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/1000/bus",
+		"-EDITOR=vim",
+		"+EDITOR=nano",
+		"-FLATPAK_ID=org.mozilla.firefox",
+		"-GTK_PATH=/snap/firefox/usr/lib/gtk-3.0",
+		"-LD_PRELOAD=/snap/firefox/lib/libhook.so",
+		"+MOZ_ENABLE_WAYLAND=1",
+		"-PATH=/snap/bin:/usr/bin",
+		"+PATH=/usr/local/bin:/usr/bin",
+		"-SNAP=/snap/firefox/42",
+	}
+	if !slices.Equal(diff, wantDiff) {
+		t.Errorf("diff =\n%s\nwant\n%s", strings.Join(diff, "\n"), strings.Join(wantDiff, "\n"))
+	}
+
+	// Without a login environment, only the stripping is left.
+	var defaults *EnvConfig
+	env, _ = defaults.sanitize(environ, nil)
+	want = []string{"EDITOR=vim", "HOME=/home/me", "PATH=/snap/bin:/usr/bin"}
+	if !slices.Equal(env, want) {
+		t.Errorf("default env = %v, want %v", env, want)
+	}
+
+	if err := (&EnvConfig{Mode: "none"}).check(); err == nil {
+		t.Error("unknown env mode accepted")
+	}
+}
+
+func TestOpenerEnv(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("LD_PRELOAD", "/tmp/hook.so")
+
+	cfg := &Config{Env: &EnvConfig{Mode: envInherit}, Debug: true}
+	if env := cfg.openerEnv(); env != nil {
+		t.Errorf("inherit mode env = %v, want nil", env)
+	}
+
+	cfg.Env.Mode = envClean
+	env := cfg.openerEnv()
+	if slices.ContainsFunc(env, func(kv string) bool { return strings.HasPrefix(kv, "LD_PRELOAD=") }) {
+		t.Error("LD_PRELOAD passed on in clean mode")
+	}
+	path, err := DebugLogPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(log), "env -LD_PRELOAD=/tmp/hook.so") {
+		t.Errorf("debug log = %q, %v; want the LD_PRELOAD change", log, err)
+	}
+}
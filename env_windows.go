@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+// loginEnv returns nothing on Windows, which has no confined browsers that
+// change the environment.
+func loginEnv() (map[string]string, error) {
+	return nil, nil
+}
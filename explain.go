@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Explanation records every step HandleURL would take for an input, without
+// opening anything or showing dialogs.
+type Explanation struct {
+	Input    string       `json:"input"`
+	Parsed   string       `json:"parsed,omitempty"`
+	Mode     string       `json:"mode,omitempty"`
+	Expand   []Step       `json:"expand,omitempty"`
+	Path     string       `json:"path,omitempty"`
+	Symlinks []string     `json:"symlinks,omitempty"`
+	Config   string       `json:"config,omitempty"`
+	Local    []Step       `json:"local,omitempty"`
+	Matches  []Step       `json:"matches,omitempty"`
+	Action   string       `json:"action,omitempty"`
+	Rule     string       `json:"rule,omitempty"`
+	Why      []Step       `json:"why,omitempty"`
+	Origin   string       `json:"origin,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Scan     []string     `json:"scan,omitempty"`
+	Snapshot string       `json:"snapshot,omitempty"`
+	Opener   []string     `json:"opener,omitempty"`
+	Env      []string     `json:"env,omitempty"`
+	Dialog   *DialogTrace `json:"dialog,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Step is one named value in an explanation.
+type Step struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DialogTrace is the dialog HandleURL would show.
+type DialogTrace struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// readOnly is set while explaining. Nothing that only records state, such
+// as the hash cache, the last good policy copy or the debug log, is
+// written.
+var readOnly bool
+
+// Explain runs the HandleURL pipeline for input, an ope:// URL or a plain
+// path, and records each step. It opens nothing, shows no dialog and
+// writes no files. The only commands it runs are queries: xdg-mime to find
+// the application a sandbox would run and, on Linux, systemctl for the
+// login environment.
+func Explain(input string) *Explanation {
+	readOnly = true
+	defer func() { readOnly = false }()
+
+	e := &Explanation{Input: input}
+	fail := func(title string, err error) *Explanation {
+		e.Error = err.Error()
+		e.Dialog = &DialogTrace{Kind: "error", Title: title, Message: err.Error()}
+		return e
+	}
+
+	path := input
+	if strings.HasPrefix(input, "ope:") {
+		parsed, err := ParseOpeURL(input)
+		if err != nil {
+			return fail("Invalid URL", err)
+		}
+		e.Parsed = parsed
+		path = parsed
+		if e.Mode, err = URLMode(input); err != nil {
+			return fail("Invalid URL", err)
+		}
+	}
+
+	path, err := expandPath(path, func(step, result string) {
+		e.Expand = append(e.Expand, Step{step, result})
+	})
+	if err != nil {
+		return fail("Path Error", err)
+	}
+	e.Path = path
+
+	configPath, source, err := resolveConfigPath()
+	if err == nil {
+		e.Config = fmt.Sprintf("%s (%s)", configPath, source)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fail("Config Error", err)
+	}
+
+	chain := symlinkChain(path)
+	if len(chain) > 1 {
+		e.Symlinks = chain
+	}
+	if !cfg.kiosk() {
+		policies, skipped := findLocalPolicies(chain[len(chain)-1])
+		for _, lp := range policies {
+			status := "applied"
+			if lp.err != nil {
+				status = "unreadable, blocks everything: " + lp.err.Error()
+			}
+			e.Local = append(e.Local, Step{lp.path, status})
+		}
+		for _, err := range skipped {
+			msg := err.Error()
+			var insecure *InsecureConfigError
+			if errors.As(err, &insecure) {
+				msg = insecure.Path + ": " + insecure.Problem
+			}
+			e.Local = append(e.Local, Step{"skipped", msg})
+		}
+	}
+
+	pin, pinErr := pinFile(path)
+	if pinErr == nil {
+		defer pin.Close()
+	}
+	v := cfg.checkPinned(path, pin)
+	e.Action = v.Action.String()
+	e.Rule = v.Rule
+	e.Warnings = v.Warnings
+	if v.Origin != nil {
+		e.Origin = v.Origin.Source()
+	}
+	e.Matches = cfg.entryMatches(chain, v.Origin)
+	for _, rule := range cfg.Rules {
+		if !strings.HasPrefix(v.Rule, "rule: "+rule.Source) {
+			continue
+		}
+		facts := newFileFacts(v.Target, v.Origin, pin)
+		for _, name := range rule.Attributes() {
+			e.Why = append(e.Why, Step{name, fmt.Sprint(facts.get(name))})
+		}
+		break
+	}
+
+	if v.Action == ActionBlock {
+		if !cfg.Silent {
+			e.Dialog = &DialogTrace{Kind: "error", Title: "Blocked", Message: blockedMessage(path, v)}
+		}
+		return e
+	}
+	if pinErr != nil {
+		if !cfg.Silent {
+			e.Dialog = &DialogTrace{Kind: "error", Title: "Not Found", Message: pinErr.Error()}
+		}
+		return e
+	}
+	if cfg.Scanner != nil && cfg.Scanner.wants(v) {
+		e.Scan = cfg.Scanner.args(v.Target)
+	}
+	if v.Action == ActionAsk || v.Action == ActionAskAlways {
+		e.Dialog = &DialogTrace{Kind: "confirm", Title: "ope — Confirm", Message: confirmMessage(path, v)}
+	}
+	// After a dialog, what the verdict was turned from is carried out.
+	action := v.Action
+	if action == ActionAsk || action == ActionAskAlways {
+		action = v.Then
+	}
+	opener, failure := openerCommand, ""
+	switch action {
+	case ActionSandbox:
+		opener, failure = sandboxCommand, "Sandbox Error"
+	case ActionReveal:
+		opener, failure = revealCommand, "Reveal Error"
+	case ActionCopyPath:
+		opener = func(string) ([]string, error) { return clipboardCommand() }
+		failure = "Clipboard Error"
+	case ActionOpenWith:
+		opener = func(path string) ([]string, error) { return openWithCommand(path, v.App) }
+	}
+	if action == ActionSnapshot || (e.Mode == modeSnapshot && action.opens() && action != ActionSandbox) {
+		if root, err := SnapshotRoot(); err == nil {
+			e.Snapshot = root
+		}
+	}
+	if args, err := opener(v.Target); err == nil {
+		e.Opener = args
+	} else if failure != "" && e.Dialog == nil {
+		e.Dialog = &DialogTrace{Kind: "error", Title: failure, Message: err.Error()}
+	}
+	_, e.Env = cfg.environment()
+	return e
+}
+
+// entryMatches lists every blocked and allowed entry, negated ones included,
+// that matches the path or one of its symlink hops, not just the one that
+// decided.
+func (c *Config) entryMatches(chain []string, origin *Origin) []Step {
+	var matches []Step
+	target := chain[len(chain)-1]
+	for _, list := range []struct {
+		name    string
+		entries []string
+	}{{"policy blocked", c.policyBlocked}, {"blocked", c.Blocked}, {"allowed", c.Allowed}} {
+		for _, entry := range list.entries {
+			pattern, _ := cutNegation(entry)
+			for _, hop := range chain {
+				f := candidate{path: hop, origin: origin, isDir: isDirFunc(hop), named: list.name == "allowed"}
+				if hop == target {
+					f.sum = func() string { return fileHash(target, nil) }
+				}
+				if matchPattern(pattern, "", f) {
+					matches = append(matches, Step{list.name + ": " + entry, hop})
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// writeText prints the explanation for humans.
+func (e *Explanation) writeText(w io.Writer) {
+	line := func(label, value string) {
+		fmt.Fprintf(w, "%-10s %s\n", label+":", value)
+	}
+	steps := func(label string, list []Step) {
+		for i, s := range list {
+			if i > 0 {
+				label = ""
+			} else {
+				label += ":"
+			}
+			fmt.Fprintf(w, "%-10s %s → %s\n", label, s.Name, s.Value)
+		}
+	}
+
+	line("Input", e.Input)
+	if e.Parsed != "" {
+		line("Parsed", e.Parsed)
+	}
+	if e.Mode != "" {
+		line("Mode", e.Mode)
+	}
+	steps("Expand", e.Expand)
+	if e.Path != "" {
+		line("Path", visibleName(e.Path))
+	}
+	if len(e.Symlinks) > 0 {
+		line("Symlinks", strings.Join(e.Symlinks, " → "))
+	}
+	if e.Config != "" {
+		line("Config", e.Config)
+	}
+	steps("Local", e.Local)
+	steps("Matches", e.Matches)
+	if e.Action != "" {
+		line("Action", e.Action)
+		line("Rule", e.Rule)
+	}
+	steps("Why", e.Why)
+	if e.Origin != "" {
+		line("Origin", e.Origin)
+	}
+	for _, warning := range e.Warnings {
+		line("Warning", warning)
+	}
+	if len(e.Scan) > 0 {
+		line("Scan", strings.Join(e.Scan, " ")+"  (not run)")
+	}
+	if e.Snapshot != "" {
+		line("Snapshot", "read-only copy in "+e.Snapshot+", opened instead of the file")
+	}
+	if len(e.Opener) > 0 {
+		line("Opener", strings.Join(e.Opener, " ")+"  (not run)")
+	}
+	for _, change := range e.Env {
+		line("Env", change)
+	}
+	if e.Dialog != nil {
+		line("Dialog", fmt.Sprintf("%s %q", e.Dialog.Title, e.Dialog.Message))
+	}
+	if e.Error != "" {
+		line("Error", e.Error)
+	}
+}
+
+// runExplain implements `ope explain [--json] <url-or-path>`.
+func runExplain(args []string) error {
+	asJSON := false
+	if len(args) > 0 && args[0] == "--json" {
+		asJSON = true
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ope explain [--json] <url-or-path>")
+	}
+
+	e := Explain(args[0])
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+	e.writeText(os.Stdout)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+blocked: ["*.sh"]
+allowed: ["*.txt"]
+rules:
+  - ask if ext == ".log" and size > 1KB
+`,
+	})
+	oldSystem := systemConfigFile
+	systemConfigFile = filepath.Join(dir, "system.yml")
+	t.Cleanup(func() { systemConfigFile = oldSystem })
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	files := t.TempDir()
+	for name, size := range map[string]int{"notes.txt": 1, "run.sh": 1, "big.log": 4096} {
+		if err := os.WriteFile(filepath.Join(files, name), make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(files, "run.sh"), filepath.Join(files, "notes-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	e := Explain("ope://" + filepath.Join(files, "notes.txt"))
+	if e.Parsed != filepath.Join(files, "notes.txt") || e.Action != "allow" || e.Rule != "allowed: *.txt" {
+		t.Errorf("notes.txt: %+v", e)
+	}
+	if len(e.Opener) == 0 || e.Dialog != nil {
+		t.Errorf("notes.txt: opener %v, dialog %+v", e.Opener, e.Dialog)
+	}
+
+	e = Explain(filepath.Join(files, "notes-link.txt"))
+	if e.Parsed != "" || e.Action != "block" || len(e.Symlinks) != 2 {
+		t.Errorf("notes-link.txt: %+v", e)
+	}
+	if len(e.Matches) != 2 || e.Dialog == nil || e.Dialog.Title != "Blocked" || e.Opener != nil {
+		t.Errorf("notes-link.txt: matches %v, dialog %+v, opener %v", e.Matches, e.Dialog, e.Opener)
+	}
+
+	e = Explain(filepath.Join(files, "big.log"))
+	if e.Action != "ask" || e.Dialog == nil || e.Dialog.Kind != "confirm" {
+		t.Errorf("big.log: %+v", e)
+	}
+	want := []Step{{"ext", ".log"}, {"size", "4096"}}
+	if len(e.Why) != len(want) || e.Why[0] != want[0] || e.Why[1] != want[1] {
+		t.Errorf("big.log: why = %v, want %v", e.Why, want)
+	}
+
+	e = Explain("ope:///tmp/../etc/passwd")
+	if e.Error == "" || e.Action != "" {
+		t.Errorf("traversal: %+v", e)
+	}
+
+	data, err := json.Marshal(Explain(filepath.Join(files, "notes.txt")))
+	if err != nil || !strings.Contains(string(data), `"action":"allow"`) {
+		t.Errorf("json = %s, %v", data, err)
+	}
+}
+
+func TestExplainWritesNothing(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+allowed: ["sha256:0000000000000000000000000000000000000000000000000000000000000000"]
+debug: true
+`,
+	})
+	oldSystem := systemConfigFile
+	systemConfigFile = filepath.Join(dir, "system.yml")
+	t.Cleanup(func() { systemConfigFile = oldSystem })
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	t.Setenv("LD_PRELOAD", "/tmp/hook.so")
+
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(file, []byte("notes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := Explain(file)
+	if e.Action != "ask" || len(e.Env) == 0 {
+		t.Fatalf("notes.txt: %+v", e)
+	}
+	if entries, _ := os.ReadDir(state); len(entries) != 0 {
+		t.Errorf("explain wrote to the state directory: %v", entries)
+	}
+	if readOnly {
+		t.Error("readOnly still set after Explain")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// attribute describes a file attribute usable in rule conditions.
+type attribute struct {
+	kind valueKind
+	get  func(f *fileFacts) any
+}
+
+// attributes lists every name rule conditions may refer to. Strings are
+// lowercased where the underlying value is case-insensitive in practice.
+var attributes = map[string]attribute{
+	"path":   {kindString, func(f *fileFacts) any { return f.path }},
+	"name":   {kindString, func(f *fileFacts) any { return strings.ToLower(filepath.Base(f.path)) }},
+	"ext":    {kindString, func(f *fileFacts) any { return strings.ToLower(filepath.Ext(f.path)) }},
+	"type":   {kindString, (*fileFacts).fileType},
+	"size":   {kindInt, (*fileFacts).size},
+	"age":    {kindInt, (*fileFacts).age},
+	"mode":   {kindInt, (*fileFacts).mode},
+	"owner":  {kindString, func(f *fileFacts) any { return f.platform().owner }},
+	"uid":    {kindInt, func(f *fileFacts) any { return f.platform().uid }},
+	"fstype": {kindString, func(f *fileFacts) any { return f.platform().fstype }},
+	"mime":   {kindString, (*fileFacts).mimeType},
+	"depth":  {kindInt, (*fileFacts).depth},
+	"hidden": {kindBool, (*fileFacts).hidden},
+	"origin": {kindString, (*fileFacts).originHost},
+	"sha256": {kindString, func(f *fileFacts) any { return fileHash(f.path, f.pin) }},
+}
+
+// fileFacts lazily gathers the attributes of one file for rule evaluation.
+type fileFacts struct {
+	path    string
+	origin  *Origin
+	pin     *pinnedFile
+	info    os.FileInfo
+	statErr error
+	plat    *platformFacts
+	cache   map[string]any
+}
+
+// platformFacts holds attributes that need OS-specific system calls.
+type platformFacts struct {
+	owner  string
+	uid    int64
+	fstype string
+}
+
+// newFileFacts prepares attribute lookup for path. If pin is not nil, stat
+// and content attributes come from the pinned handle.
+func newFileFacts(path string, origin *Origin, pin *pinnedFile) *fileFacts {
+	f := &fileFacts{path: path, origin: origin, pin: pin, cache: map[string]any{}}
+	if pin != nil {
+		f.info = pin.info
+	} else {
+		f.info, f.statErr = os.Stat(path)
+	}
+	return f
+}
+
+func (f *fileFacts) get(name string) any {
+	if v, ok := f.cache[name]; ok {
+		return v
+	}
+	v := attributes[name].get(f)
+	f.cache[name] = v
+	return v
+}
+
+func (f *fileFacts) platform() *platformFacts {
+	if f.plat == nil {
+		f.plat = &platformFacts{uid: -1}
+		if f.statErr == nil {
+			readPlatformFacts(f.path, f.info, f.pin, f.plat)
+		}
+	}
+	return f.plat
+}
+
+func (f *fileFacts) fileType() any {
+	switch {
+	case f.statErr != nil:
+		return "missing"
+	case f.info.IsDir():
+		return "dir"
+	case f.info.Mode().IsRegular():
+		return "file"
+	default:
+		return "other"
+	}
+}
+
+func (f *fileFacts) size() any {
+	if f.statErr != nil {
+		return int64(0)
+	}
+	return f.info.Size()
+}
+
+// age is the time since the last modification, in seconds.
+func (f *fileFacts) age() any {
+	if f.statErr != nil {
+		return int64(0)
+	}
+	return int64(time.Since(f.info.ModTime()) / time.Second)
+}
+
+// mode returns the Unix permission bits, including setuid, setgid and sticky.
+func (f *fileFacts) mode() any {
+	if f.statErr != nil {
+		return int64(0)
+	}
+	m := f.info.Mode()
+	bits := int64(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// mimeType sniffs the first 512 bytes of the content, falling back to the
+// extension when the content is inconclusive.
+func (f *fileFacts) mimeType() any {
+	if f.statErr != nil {
+		return ""
+	}
+	if f.info.IsDir() {
+		return "inode/directory"
+	}
+	if !f.info.Mode().IsRegular() {
+		return ""
+	}
+	var r io.ReaderAt
+	if f.pin != nil {
+		r = f.pin.file
+	} else {
+		fh, err := os.Open(f.path)
+		if err != nil {
+			return ""
+		}
+		defer fh.Close()
+		r = fh
+	}
+	buf := make([]byte, 512)
+	n, _ := r.ReadAt(buf, 0)
+	detected := http.DetectContentType(buf[:n])
+	if strings.HasPrefix(detected, "application/octet-stream") || strings.HasPrefix(detected, "text/plain") {
+		if byExt := mime.TypeByExtension(filepath.Ext(f.path)); byExt != "" {
+			detected = byExt
+		}
+	}
+	detected, _, _ = strings.Cut(detected, ";")
+	return strings.TrimSpace(detected)
+}
+
+// depth is the number of directories above the path.
+func (f *fileFacts) depth() any {
+	dir := filepath.Dir(filepath.Clean(f.path))
+	dir = strings.TrimPrefix(dir, filepath.VolumeName(dir))
+	dir = strings.Trim(dir, string(filepath.Separator))
+	if dir == "" || dir == "." {
+		return int64(0)
+	}
+	return int64(strings.Count(dir, string(filepath.Separator)) + 1)
+}
+
+// hidden reports whether the file or any directory above it is a dotfile.
+func (f *fileFacts) hidden() any {
+	for _, part := range strings.Split(filepath.ToSlash(f.path), "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fileFacts) originHost() any {
+	if f.origin == nil {
+		return ""
+	}
+	return f.origin.Host()
+}
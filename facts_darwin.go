@@ -0,0 +1,59 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// readPlatformFacts fills in the owner and the filesystem type, the latter
+// from pin if it is not nil.
+func readPlatformFacts(path string, info os.FileInfo, pin *pinnedFile, p *platformFacts) {
+	if uid, ok := fileOwner(info); ok {
+		p.uid = int64(uid)
+		p.owner = strconv.FormatInt(p.uid, 10)
+		if u, err := user.LookupId(p.owner); err == nil {
+			p.owner = u.Username
+		}
+	}
+
+	var fs syscall.Statfs_t
+	statfs := func() error { return syscall.Statfs(path, &fs) }
+	if pin != nil {
+		statfs = func() error { return syscall.Fstatfs(int(pin.file.Fd()), &fs) }
+	}
+	if err := statfs(); err == nil {
+		name := make([]byte, 0, len(fs.Fstypename))
+		for _, c := range fs.Fstypename {
+			if c == 0 {
+				break
+			}
+			name = append(name, byte(c))
+		}
+		p.fstype = string(name)
+	}
+}
+
+// fileOwner returns the uid that owns the file.
+func fileOwner(info os.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+// fileIdentity returns the device, inode and status change time of the file.
+// Unlike the modification time, the change time can't be set back, so a
+// file whose identity is unchanged still has the same content.
+func fileIdentity(info os.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d:%d", uint64(st.Dev), st.Ino, st.Ctimespec.Nano()), true
+}
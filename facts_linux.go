@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// fsMagic maps statfs f_type values to filesystem names.
+var fsMagic = map[int64]string{
+	0xef53:     "ext4",
+	0x9123683e: "btrfs",
+	0x58465342: "xfs",
+	0x01021994: "tmpfs",
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x517b:     "smb",
+	0x65735546: "fuse",
+	0x794c7630: "overlay",
+	0x4d44:     "vfat",
+	0x2011bab0: "exfat",
+	0x5346544e: "ntfs",
+	0x9660:     "iso9660",
+	0x2fc12fc1: "zfs",
+	0x73717368: "squashfs",
+	0x00c36400: "ceph",
+	0x01161970: "gfs2",
+	0x9fa0:     "proc",
+	0x62656572: "sysfs",
+}
+
+// readPlatformFacts fills in the owner and the filesystem type, the latter
+// from pin if it is not nil.
+func readPlatformFacts(path string, info os.FileInfo, pin *pinnedFile, p *platformFacts) {
+	if uid, ok := fileOwner(info); ok {
+		p.uid = int64(uid)
+		p.owner = strconv.FormatInt(p.uid, 10)
+		if u, err := user.LookupId(p.owner); err == nil {
+			p.owner = u.Username
+		}
+	}
+
+	var fs syscall.Statfs_t
+	statfs := func() error { return syscall.Statfs(path, &fs) }
+	if pin != nil {
+		statfs = func() error { return syscall.Fstatfs(int(pin.file.Fd()), &fs) }
+	}
+	if err := statfs(); err == nil {
+		name, ok := fsMagic[int64(fs.Type)]
+		if !ok {
+			name = "0x" + strconv.FormatInt(int64(fs.Type), 16)
+		}
+		p.fstype = name
+	}
+}
+
+// fileOwner returns the uid that owns the file.
+func fileOwner(info os.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+// fileIdentity returns the device, inode and status change time of the file.
+// Unlike the modification time, the change time can't be set back, so a
+// file whose identity is unchanged still has the same content.
+func fileIdentity(info os.FileInfo) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d:%d", st.Dev, st.Ino, st.Ctim.Nano()), true
+}
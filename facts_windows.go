@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// readPlatformFacts fills in the filesystem type, from pin if it is not
+// nil. File ownership on Windows is ACL-based and is not reported.
+func readPlatformFacts(path string, info os.FileInfo, pin *pinnedFile, p *platformFacts) {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	var fsName [syscall.MAX_PATH + 1]uint16
+	var r uintptr
+	if pin != nil {
+		r, _, _ = kernel32.NewProc("GetVolumeInformationByHandleW").Call(
+			pin.file.Fd(), 0, 0, 0, 0, 0,
+			uintptr(unsafe.Pointer(&fsName[0])), uintptr(len(fsName)),
+		)
+	} else {
+		root, err := syscall.UTF16PtrFromString(filepath.VolumeName(path) + `\`)
+		if err != nil {
+			return
+		}
+		r, _, _ = kernel32.NewProc("GetVolumeInformationW").Call(
+			uintptr(unsafe.Pointer(root)), 0, 0, 0, 0, 0,
+			uintptr(unsafe.Pointer(&fsName[0])), uintptr(len(fsName)),
+		)
+	}
+	if r != 0 {
+		p.fstype = strings.ToLower(syscall.UTF16ToString(fsName[:]))
+	}
+}
+
+// fileOwner is not available on Windows, where ownership is ACL-based.
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
+
+// fileIdentity is not available on Windows, where no change time is kept
+// that can't be set back; digests there are not cached.
+func fileIdentity(info os.FileInfo) (string, bool) {
+	return "", false
+}
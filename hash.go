@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// hashPrefix marks list entries that match the SHA-256 of the content
+// instead of the file name, e.g. "sha256:9f86d0... report.html". Anything
+// after the hash is a note, usually the name of the file it was taken from.
+const hashPrefix = "sha256:"
+
+// maxHashSize is the largest file that is hashed, small enough not to hold
+// up opening a file. Larger files never match sha256: entries.
+const maxHashSize = 64 << 20
+
+// hashCacheTouch is how often a cache hit updates the entry's last use,
+// which costs rewriting the whole cache.
+const hashCacheTouch = time.Hour
+
+// maxHashCacheEntries bounds the hash cache; the least recently used
+// entries are dropped beyond it.
+const maxHashCacheEntries = 2000
+
+func isHashEntry(pattern string) bool {
+	pattern, _ = cutNegation(pattern)
+	return strings.HasPrefix(strings.ToLower(pattern), hashPrefix)
+}
+
+// entryHash returns the lowercased hex digest of a sha256: entry.
+func entryHash(pattern string) string {
+	fields := strings.Fields(strings.TrimPrefix(strings.ToLower(pattern), hashPrefix))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// entryNote returns what follows the digest of a sha256: entry.
+func entryNote(pattern string) string {
+	rest := strings.TrimSpace(pattern[len(hashPrefix):])
+	_, note, _ := strings.Cut(rest, " ")
+	return strings.TrimSpace(note)
+}
+
+// hashEntry returns the entry that pins a file with the given digest.
+func hashEntry(sum, name string) string {
+	return hashPrefix + sum + " " + name
+}
+
+// allowEntry returns what "Always Allow" records for target: a sha256:
+// entry for files, so that the dialog comes back once the content changes,
+// and the name for anything else.
+func allowEntry(target string, pin *pinnedFile) string {
+	name := filepath.Base(target)
+	if sum := fileHash(target, pin); sum != "" {
+		return hashEntry(sum, name)
+	}
+	return name
+}
+
+// hashCacheEntry remembers the digest of a file as long as its size,
+// modification time and identity (see fileIdentity) stay the same.
+type hashCacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	ID      string    `json:"id"`
+	Sum     string    `json:"sha256"`
+	Used    time.Time `json:"used"`
+}
+
+// HashCachePath returns the path to the hash cache.
+func HashCachePath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hashes.json"), nil
+}
+
+func loadHashCache() map[string]hashCacheEntry {
+	cache := map[string]hashCacheEntry{}
+	path, err := HashCachePath()
+	if err != nil {
+		return cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+func saveHashCache(cache map[string]hashCacheEntry) error {
+	if readOnly {
+		return nil
+	}
+	if len(cache) > maxHashCacheEntries {
+		keys := make([]string, 0, len(cache))
+		for k := range cache {
+			keys = append(keys, k)
+		}
+		slices.SortFunc(keys, func(a, b string) int { return cache[b].Used.Compare(cache[a].Used) })
+		for _, k := range keys[maxHashCacheEntries:] {
+			delete(cache, k)
+		}
+	}
+
+	path, err := HashCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// fileHash returns the hex SHA-256 of a regular file, reading from pin if
+// it is not nil. It returns "" for directories, files over maxHashSize and
+// files that can't be read. Digests are cached by path, size, modification
+// time and identity; without an identity, the file is always read.
+func fileHash(path string, pin *pinnedFile) string {
+	var info os.FileInfo
+	var err error
+	if pin != nil {
+		info = pin.info
+	} else if info, err = os.Stat(path); err != nil {
+		return ""
+	}
+	if !info.Mode().IsRegular() || info.Size() > maxHashSize {
+		return ""
+	}
+
+	id, cacheable := fileIdentity(info)
+	var cache map[string]hashCacheEntry
+	if cacheable {
+		cache = loadHashCache()
+		if e, ok := cache[path]; ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) && e.ID == id {
+			if time.Since(e.Used) > hashCacheTouch {
+				e.Used = time.Now()
+				cache[path] = e
+				_ = saveHashCache(cache)
+			}
+			return e.Sum
+		}
+	}
+
+	var r io.Reader
+	if pin != nil {
+		r = io.NewSectionReader(pin.file, 0, info.Size())
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		r = io.LimitReader(f, info.Size())
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return ""
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	if cacheable {
+		cache[path] = hashCacheEntry{Size: info.Size(), ModTime: info.ModTime(), ID: id, Sum: sum, Used: time.Now()}
+		_ = saveHashCache(cache)
+	}
+	return sum
+}
+
+// loadHashList reads a list of known-bad digests: one per line, in the
+// format sha256sum prints, with or without the sha256: prefix. Blank lines
+// and lines starting with # are skipped.
+func loadHashList(path string) (map[string]string, error) {
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		sum := strings.TrimPrefix(strings.ToLower(fields[0]), hashPrefix)
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 2*sha256.Size {
+			return nil, fmt.Errorf("%s:%d: not a SHA-256 digest", path, n)
+		}
+		note := strings.TrimLeft(strings.Join(fields[1:], " "), "*")
+		sums[sum] = note
+	}
+	return sums, scanner.Err()
+}
+
+// checkHashLists looks sum up in the blocked hash lists and returns the
+// verdict rule for a match, or "" if there is none. An unreadable list is
+// treated as a match, so that a missing list fails closed.
+func (c *Config) checkHashLists(sum string) string {
+	for _, path := range c.BlockedHashes {
+		sums, err := loadHashList(path)
+		if err != nil {
+			return "blocked hashes: " + err.Error()
+		}
+		if note, ok := sums[sum]; ok {
+			rule := "blocked hash: " + path
+			if note != "" {
+				rule += " (" + note + ")"
+			}
+			return rule
+		}
+	}
+	return ""
+}
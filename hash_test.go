@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sha256 of "hello\n"
+const helloSum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func TestFileHash(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileHash(path, nil); got != helloSum {
+		t.Errorf("fileHash = %q, want %q", got, helloSum)
+	}
+
+	pin, err := pinFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Close()
+	if got := fileHash(path, pin); got != helloSum {
+		t.Errorf("fileHash(pinned) = %q, want %q", got, helloSum)
+	}
+	if got := fileHash(filepath.Dir(path), nil); got != "" {
+		t.Errorf("fileHash(dir) = %q, want empty", got)
+	}
+
+	cache := loadHashCache()
+	if e, ok := cache[path]; (!ok || e.Sum != helloSum) && runtime.GOOS != "windows" {
+		t.Errorf("cache[%s] = %+v", path, e)
+	}
+	if got := allowEntry(path, pin); got != "sha256:"+helloSum+" report.html" {
+		t.Errorf("allowEntry = %q", got)
+	}
+}
+
+func TestFileHashRestoredModTime(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fileHash(path, nil); got != helloSum {
+		t.Fatalf("fileHash = %q, want %q", got, helloSum)
+	}
+
+	// Same size, and the modification time set back: only the change time
+	// tells the cached digest is stale. Kernels without fine-grained
+	// timestamps advance it once per clock tick.
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("HELLO\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileHash(path, nil); got == helloSum {
+		t.Error("fileHash returned the digest cached for the old content")
+	}
+}
+
+func TestHashEntries(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.html")
+	if err := os.WriteFile(report, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{Allowed: []string{"sha256:" + strings.ToUpper(helloSum) + " report.html"}}
+	if v := cfg.CheckSecurity(report); v.Action != ActionAllow {
+		t.Errorf("pinned report.html = %v %q, want allow", v.Action, v.Rule)
+	}
+
+	// Same name, new content: the pin no longer matches.
+	if err := os.WriteFile(report, []byte("<script>evil()</script>\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if v := cfg.CheckSecurity(report); v.Action != ActionAsk {
+		t.Errorf("changed report.html = %v %q, want ask", v.Action, v.Rule)
+	}
+
+	list := filepath.Join(dir, "bad-hashes.txt")
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(list, []byte("# known bad\n"+helloSum+"  dropper.exe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{Allowed: []string{"*.txt"}, BlockedHashes: []string{list}}
+	if v := cfg.CheckSecurity(other); v.Action != ActionBlock || v.Rule != "blocked hash: "+list+" (dropper.exe)" {
+		t.Errorf("known-bad notes.txt = %v %q, want block", v.Action, v.Rule)
+	}
+	if v := cfg.CheckSecurity(dir); v.Action != ActionAllow {
+		t.Errorf("directory = %v %q, want allow", v.Action, v.Rule)
+	}
+
+	cfg.BlockedHashes = []string{filepath.Join(dir, "missing.txt")}
+	if v := cfg.CheckSecurity(other); v.Action != ActionBlock {
+		t.Errorf("missing hash list = %v %q, want block", v.Action, v.Rule)
+	}
+
+	cfg = &Config{Blocked: []string{"sha256:" + helloSum}}
+	if v := cfg.CheckSecurity(other); v.Action != ActionBlock {
+		t.Errorf("blocked digest = %v %q, want block", v.Action, v.Rule)
+	}
+
+	// An allowed digest noted with another name isn't even computed, while
+	// a blocked one matches whatever the note says.
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	cfg = &Config{Allowed: []string{"sha256:" + helloSum + " report.html"}}
+	if v := cfg.CheckSecurity(other); v.Action != ActionAsk {
+		t.Errorf("digest allowed for another name = %v %q, want ask", v.Action, v.Rule)
+	}
+	if cache := loadHashCache(); len(cache) != 0 {
+		t.Errorf("notes.txt was hashed for an entry about report.html: %v", cache)
+	}
+	cfg = &Config{Blocked: []string{"sha256:" + helloSum + " dropper.exe"}}
+	if v := cfg.CheckSecurity(other); v.Action != ActionBlock {
+		t.Errorf("blocked digest with another name = %v %q, want block", v.Action, v.Rule)
+	}
+}
+
+func TestHashCacheHit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("digests are not cached on Windows")
+	}
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fileHash(path, nil)
+	cachePath, _ := HashCachePath()
+	before, err := os.Stat(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A hit within hashCacheTouch leaves the cache file alone.
+	old := before.ModTime().Add(-time.Minute)
+	if err := os.Chtimes(cachePath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileHash(path, nil); got != helloSum {
+		t.Errorf("fileHash = %q, want %q", got, helloSum)
+	}
+	if after, err := os.Stat(cachePath); err != nil || !after.ModTime().Equal(old) {
+		t.Errorf("cache rewritten on a fresh hit")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is one request in the history file.
+type HistoryEntry struct {
+	Time   time.Time `json:"time"`
+	URL    string    `json:"url"`
+	Action string    `json:"action"`
+	Rule   string    `json:"rule"`
+}
+
+// maxHistorySize is the size at which the history file is rotated to
+// history.jsonl.1, replacing the previous rotation.
+const maxHistorySize = 4 << 20
+
+// HistoryPath returns the path to the request history file.
+func HistoryPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// recordHistory appends a request and its verdict to the history file.
+func recordHistory(raw string, v Verdict) error {
+	path, err := HistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > maxHistorySize {
+		_ = os.Rename(path, path+".1")
+	}
+
+	line, err := json.Marshal(HistoryEntry{Time: time.Now().UTC(), URL: raw, Action: v.Action.String(), Rule: v.Rule})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readHistory reads requests from r: either history file lines, or one URL
+// or path per line. Blank lines and lines starting with # are skipped.
+func readHistory(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 2*maxURLLength)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "{"):
+			var entry HistoryEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			urls = append(urls, entry.URL)
+		default:
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// inputPath turns an ope:// URL, or a plain path, into the path that would
+// be checked.
+func inputPath(input string) (string, error) {
+	path := input
+	if strings.HasPrefix(input, "ope:") {
+		var err error
+		if path, err = ParseOpeURL(input); err != nil {
+			return "", err
+		}
+	}
+	return ExpandPath(path)
+}
+
+// flip is a request whose verdict differs between two configs.
+type flip struct {
+	url      string
+	count    int
+	from, to Verdict
+}
+
+// simulate replays urls through both configs and returns the requests whose
+// action changes, in order of first appearance, along with the number of
+// requests replayed. URLs that no longer parse are skipped.
+func simulate(urls []string, current, candidate *Config) (flips []*flip, replayed int) {
+	seen := map[string]*flip{}
+	for _, url := range urls {
+		path, err := inputPath(url)
+		if err != nil {
+			continue
+		}
+		replayed++
+		if f, ok := seen[url]; ok {
+			if f != nil {
+				f.count++
+			}
+			continue
+		}
+		from, to := current.CheckSecurity(path), candidate.CheckSecurity(path)
+		if from.Action == to.Action {
+			seen[url] = nil
+			continue
+		}
+		f := &flip{url: url, count: 1, from: from, to: to}
+		seen[url] = f
+		flips = append(flips, f)
+	}
+	return flips, replayed
+}
+
+// loadCandidateConfig loads path the way LoadConfig loads the user's config,
+// with when blocks, environment overrides, the system policy and learned
+// decisions applied, so that only the file itself differs.
+func loadCandidateConfig(path string) (*Config, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	saved := configFlag
+	configFlag = path
+	defer func() { configFlag = saved }()
+	return LoadConfig()
+}
+
+// runSimulate implements `ope policy simulate --config <file> [--history <file>]`.
+func runSimulate(args []string) error {
+	const usage = "usage: ope policy simulate --config <file> [--history <file>]"
+	var candidatePath, historyPath string
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return fmt.Errorf(usage)
+		}
+		switch args[0] {
+		case "--config":
+			candidatePath = args[1]
+		case "--history":
+			historyPath = args[1]
+		default:
+			return fmt.Errorf(usage)
+		}
+		args = args[2:]
+	}
+	if candidatePath == "" {
+		return fmt.Errorf(usage)
+	}
+
+	if historyPath == "" {
+		var err error
+		if historyPath, err = HistoryPath(); err != nil {
+			return err
+		}
+	}
+	var in io.Reader = os.Stdin
+	if historyPath != "-" {
+		f, err := os.Open(historyPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	urls, err := readHistory(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", historyPath, err)
+	}
+
+	current, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	candidate, err := loadCandidateConfig(candidatePath)
+	if err != nil {
+		return err
+	}
+
+	flips, replayed := simulate(urls, current, candidate)
+	changed := map[string]int{}
+	total := 0
+	for _, f := range flips {
+		fmt.Printf("%-5s → %-5s %4d×  %s\n", f.from.Action, f.to.Action, f.count, f.url)
+		fmt.Printf("%19s was %s\n", "", f.from.Rule)
+		fmt.Printf("%19s now %s\n", "", f.to.Rule)
+		changed[f.from.Action.String()+" → "+f.to.Action.String()] += f.count
+		total += f.count
+	}
+
+	fmt.Printf("\n%d of %d requests would change", total, replayed)
+	if skipped := len(urls) - replayed; skipped > 0 {
+		fmt.Printf(" (%d skipped, no longer valid)", skipped)
+	}
+	fmt.Println()
+	for from := range SecurityAction(len(actionStrings)) {
+		for to := range SecurityAction(len(actionStrings)) {
+			if n := changed[from.String()+" → "+to.String()]; n > 0 {
+				fmt.Printf("  %-5s → %-5s %d\n", from, to, n)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordHistory(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	v := Verdict{Action: ActionBlock, Rule: "blocked: *.sh"}
+	for _, url := range []string{"ope:///tmp/a.sh", "ope:///tmp/b.sh"} {
+		if err := recordHistory(url, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, _ := HistoryPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("history mode = %o, want 600", perm)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	urls, err := readHistory(f)
+	if err != nil || len(urls) != 2 || urls[1] != "ope:///tmp/b.sh" {
+		t.Errorf("readHistory = %v, %v", urls, err)
+	}
+}
+
+func TestReadHistoryList(t *testing.T) {
+	urls, err := readHistory(strings.NewReader("# team links\nope:///tmp/a\n\n/tmp/b\n"))
+	if err != nil || len(urls) != 2 || urls[0] != "ope:///tmp/a" || urls[1] != "/tmp/b" {
+		t.Errorf("readHistory = %v, %v", urls, err)
+	}
+	if _, err := readHistory(strings.NewReader("{bad\n")); err == nil {
+		t.Error("readHistory accepted a malformed history line")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"deploy.sh", "notes.txt", "report.pdf"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current := &Config{Allowed: []string{"*.sh", "*.txt"}}
+	candidate := &Config{Blocked: []string{"*.sh"}, Allowed: []string{"*.txt", "*.pdf"}}
+
+	urls := []string{
+		"ope://" + filepath.Join(dir, "deploy.sh"),
+		"ope://" + filepath.Join(dir, "notes.txt"),
+		"ope://" + filepath.Join(dir, "deploy.sh"),
+		filepath.Join(dir, "report.pdf"),
+		"ope:///tmp/../etc/passwd",
+	}
+	flips, replayed := simulate(urls, current, candidate)
+	if replayed != 4 {
+		t.Errorf("replayed = %d, want 4", replayed)
+	}
+	if len(flips) != 2 {
+		t.Fatalf("flips = %d, want 2", len(flips))
+	}
+	if f := flips[0]; f.count != 2 || f.from.Action != ActionAllow || f.to.Action != ActionBlock {
+		t.Errorf("deploy.sh: %d× %v → %v", f.count, f.from.Action, f.to.Action)
+	}
+	if f := flips[1]; f.count != 1 || f.from.Action != ActionAsk || f.to.Action != ActionAllow {
+		t.Errorf("report.pdf: %d× %v → %v", f.count, f.from.Action, f.to.Action)
+	}
+}
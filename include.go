@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadLayer applies the config file at path, whose content is data, on top
+// of c. The files it lists under include are applied first, in order, each
+// after its own includes. Later layers win: lists are concatenated and
+// settings from later files replace earlier ones, so the including file
+// always has the last word.
+//
+// Relative include paths are resolved against the including file's
+// directory. stack holds the files currently being loaded, to detect loops.
+func (c *Config) loadLayer(path string, data []byte, stack []string) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(node.Content) == 0 {
+		return nil
+	}
+	doc := node.Content[0]
+
+	var head struct {
+		Include []string `yaml:"include"`
+	}
+	if err := doc.Decode(&head); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	stack = append(stack, path)
+	for _, inc := range head.Include {
+		incPath := expandHome(inc)
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(filepath.Dir(path), incPath)
+		}
+		incPath = filepath.Clean(incPath)
+
+		for _, loading := range stack {
+			if loading == incPath {
+				return fmt.Errorf("include loop: %s -> %s", strings.Join(stack, " -> "), incPath)
+			}
+		}
+
+		if err := checkFilePerms(incPath, true); err != nil {
+			return err
+		}
+		incData, err := os.ReadFile(incPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s: included file not found: %s", path, incPath)
+			}
+			return fmt.Errorf("%s: include %s: %w", path, incPath, err)
+		}
+		if err := c.loadLayer(incPath, incData, stack); err != nil {
+			return err
+		}
+	}
+
+	if err := c.overlay(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configFlag = filepath.Join(dir, "ope.yml")
+	t.Cleanup(func() { configFlag = "" })
+	return dir
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+include: [team/policy.yml]
+allowed: ["*.pdf"]
+silent: false
+`,
+		"team/policy.yml": `
+include: [base.yml]
+blocked: ["*.sh"]
+silent: true
+rules:
+  - ask if size > 1GB
+`,
+		"team/base.yml": `
+blocked: ["*.exe"]
+allowed: ["*.txt"]
+`,
+	})
+
+	cfg, err := loadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(cfg.Blocked[:2], " ") != "*.exe *.sh" {
+		t.Errorf("Blocked = %v, want base entries first, then team", cfg.Blocked)
+	}
+	if containsFold(cfg.Blocked, "*.bat") {
+		t.Errorf("included blocklist should replace the built-in one: %v", cfg.Blocked)
+	}
+	if strings.Join(cfg.Allowed, " ") != "*.txt *.pdf" {
+		t.Errorf("Allowed = %v, want [*.txt *.pdf]", cfg.Allowed)
+	}
+	if cfg.Silent {
+		t.Error("the including file should override silent")
+	}
+	if len(cfg.Rules) != 1 {
+		t.Errorf("Rules = %v, want the included rule", cfg.Rules)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	writeConfigFiles(t, map[string]string{
+		"ope.yml": "include: [a.yml]\n",
+		"a.yml":   "include: [b.yml]\n",
+		"b.yml":   "include: [a.yml]\n",
+	})
+	if _, err := loadConfigFile(); err == nil || !strings.Contains(err.Error(), "include loop") {
+		t.Errorf("loop: got %v, want include loop error", err)
+	}
+
+	writeConfigFiles(t, map[string]string{
+		"ope.yml": "include: [missing.yml]\n",
+	})
+	if _, err := loadConfigFile(); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing: got %v, want not found error", err)
+	}
+}
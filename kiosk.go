@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Modes for the mode setting.
+const (
+	modeNormal = "normal"
+	// modeKiosk is for shared machines: only paths under Roots open, nothing
+	// ever asks, learned decisions are ignored and every request is logged.
+	modeKiosk = "kiosk"
+)
+
+// errKiosk is returned for anything kiosk mode doesn't allow.
+var errKiosk = errors.New("not allowed in kiosk mode")
+
+// kiosk reports whether the config is in kiosk mode.
+func (c *Config) kiosk() bool {
+	return c.Mode == modeKiosk
+}
+
+// checkMode rejects unknown modes, and kiosk mode without roots, which
+// would block everything.
+func (c *Config) checkMode() error {
+	switch c.Mode {
+	case "", modeNormal:
+		return nil
+	case modeKiosk:
+		if len(c.Roots) == 0 {
+			return fmt.Errorf("mode: kiosk needs at least one entry in roots")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q (want %s or %s)", c.Mode, modeNormal, modeKiosk)
+	}
+}
+
+// underRoots reports whether path lies inside one of the configured roots,
+// as written or with symlinks resolved, so that a root behind a symlink
+// matches resolved targets as well as paths that don't exist yet.
+func (c *Config) underRoots(path string) bool {
+	for _, root := range c.Roots {
+		root = expandHome(root)
+		if !filepath.IsAbs(root) {
+			continue
+		}
+		if isUnder(path, root) {
+			return true
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil && isUnder(path, resolved) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogPath returns the path to the kiosk mode request log.
+func LogPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ope.log"), nil
+}
+
+// logRequest appends one line per request to the log: time, URL, action,
+// the rule behind it and the outcome.
+func logRequest(raw string, v *Verdict, result error) error {
+	path, err := LogPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	action, rule, outcome := "-", "-", "opened"
+	if v != nil {
+		action, rule = v.Action.String(), strconv.Quote(v.Rule)
+	}
+	if result != nil {
+		outcome = strconv.Quote(result.Error())
+	} else if v == nil || !v.Action.opens() {
+		outcome = "not opened"
+	}
+	line := fmt.Sprintf("%s %s %s %s %s\n", time.Now().UTC().Format(time.RFC3339), strconv.Quote(raw), action, rule, outcome)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKioskCheckSecurity(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	for _, path := range []string{
+		filepath.Join(root, "notes.txt"),
+		filepath.Join(root, "data.bin"),
+		filepath.Join(outside, "notes.txt"),
+	} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "notes.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{Mode: modeKiosk, Roots: []string{root}, Allowed: []string{"*.txt"}}
+	tests := []struct {
+		path   string
+		action SecurityAction
+		rule   string
+	}{
+		{filepath.Join(root, "notes.txt"), ActionAllow, "allowed: *.txt"},
+		{filepath.Join(root, "data.bin"), ActionBlock, "kiosk: default: unknown file"},
+		{filepath.Join(outside, "notes.txt"), ActionBlock, "kiosk: outside roots"},
+		{filepath.Join(root, "escape.txt"), ActionBlock, "kiosk: outside roots"},
+		{root, ActionAllow, "default: directory"},
+	}
+	for _, tt := range tests {
+		v := cfg.CheckSecurity(tt.path)
+		if v.Action != tt.action || v.Rule != tt.rule {
+			t.Errorf("CheckSecurity(%q) = %v %q, want %v %q", tt.path, v.Action, v.Rule, tt.action, tt.rule)
+		}
+	}
+}
+
+func TestKioskSymlinkedRoot(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	if err := os.Mkdir(real, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{Mode: modeKiosk, Roots: []string{link}, Allowed: []string{"*.txt"}}
+	for _, path := range []string{
+		filepath.Join(link, "notes.txt"),
+		filepath.Join(real, "notes.txt"),
+	} {
+		if v := cfg.CheckSecurity(path); v.Action != ActionAllow {
+			t.Errorf("CheckSecurity(%q) = %v %q, want allow", path, v.Action, v.Rule)
+		}
+	}
+}
+
+func TestKioskCheckMode(t *testing.T) {
+	tests := []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Mode: "normal"}, true},
+		{Config{Mode: "kiosk", Roots: []string{"/srv"}}, true},
+		{Config{Mode: "kiosk"}, false},
+		{Config{Mode: "locked"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.checkMode(); (err == nil) != tt.ok {
+			t.Errorf("checkMode(%q, %v) = %v", tt.cfg.Mode, tt.cfg.Roots, err)
+		}
+	}
+}
+
+func TestKioskIgnoresDecisions(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": "mode: kiosk\nroots: [/srv]\n",
+	})
+	oldSystem := systemConfigFile
+	systemConfigFile = filepath.Join(dir, "system.yml")
+	t.Cleanup(func() { systemConfigFile = oldSystem })
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if err := RecordDecision(true, "*.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsFold(cfg.Allowed, "*.bin") {
+		t.Errorf("kiosk config merged learned decisions: %v", cfg.Allowed)
+	}
+	if err := runDecisions([]string{"promote", "*.bin"}); !errors.Is(err, errKiosk) {
+		t.Errorf("promote in kiosk mode = %v, want %v", err, errKiosk)
+	}
+
+	v := Verdict{Action: ActionBlock, Rule: "kiosk: outside roots"}
+	if err := logRequest("ope:///etc/passwd", &v, errors.New("blocked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := logRequest("ope://bad", nil, errors.New("invalid")); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := LogPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"ope:///etc/passwd" block "kiosk: outside roots" "blocked"`) {
+		t.Errorf("log = %q", data)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localPolicyName is the name of per-directory policy files.
+const localPolicyName = ".ope.yml"
+
+// LocalPolicy is a .ope.yml file in a directory, set up by whoever owns a
+// project tree. It applies to everything below that directory, on top of
+// the user's config: its blocked entries block even where the user's list
+// takes a file back with "!", its allowed entries are checked after the
+// user's and its rules, which can't use open-with, after the user's rules.
+type LocalPolicy struct {
+	// Root stops the search for further .ope.yml files in parent
+	// directories, like root = true in .editorconfig.
+	Root    bool     `yaml:"root"`
+	Blocked []string `yaml:"blocked"`
+	Allowed []string `yaml:"allowed"`
+	Rules   []Rule   `yaml:"rules"`
+
+	path string
+	err  error // set if the file exists but couldn't be read
+}
+
+// dir returns the directory the policy applies to, which path patterns in
+// it are relative to.
+func (p *LocalPolicy) dir() string {
+	return filepath.Dir(p.path)
+}
+
+// source describes the file for verdict rules.
+func (p *LocalPolicy) source() string {
+	return " (from " + visibleName(p.path) + ")"
+}
+
+// findLocalPolicies returns the .ope.yml files that apply to path, from the
+// outermost to the nearest, searching from path's directory up to the
+// filesystem root or the first file with root: true. Files that someone
+// other than the user or root could have written are skipped and returned
+// as errors; see checkFilePerms.
+func findLocalPolicies(path string) (policies []*LocalPolicy, skipped []error) {
+	dir := filepath.Dir(path)
+	for {
+		p, err := loadLocalPolicy(filepath.Join(dir, localPolicyName))
+		if err != nil {
+			skipped = append(skipped, err)
+		}
+		if p != nil {
+			policies = append(policies, p)
+			if p.Root {
+				break
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for i, j := 0, len(policies)-1; i < j; i, j = i+1, j-1 {
+		policies[i], policies[j] = policies[j], policies[i]
+	}
+	return policies, skipped
+}
+
+// loadLocalPolicy reads one .ope.yml. It returns nil for a missing or
+// untrusted file, and a policy with err set for a file that can't be read
+// or parsed, which the caller must treat as a block.
+func loadLocalPolicy(path string) (*LocalPolicy, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil
+	}
+	if err := checkFilePerms(path, false); err != nil {
+		return nil, err
+	}
+
+	p := &LocalPolicy{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.err = err
+		return p, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		p.err = fmt.Errorf("%s: %w", path, err)
+		return p, nil
+	}
+	// Whoever wrote the file, e.g. the author of a cloned repository, must
+	// not get to run commands: open-with takes any command line. Everything
+	// else opens files the way allowed entries do, or more carefully.
+	for _, rule := range p.Rules {
+		if rule.Action == ActionOpenWith {
+			p.err = fmt.Errorf("%s: %s rules aren't allowed in %s: %s", path, rule.Action, localPolicyName, rule.Source)
+			break
+		}
+	}
+	return p, nil
+}
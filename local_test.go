@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLocalPolicies(t *testing.T) {
+	tree := t.TempDir()
+	files := map[string]string{
+		"project/.ope.yml":              "root: true\nblocked: [\"*.sh\"]\nallowed: [\"reports/\"]\n",
+		"project/reports/q3.xlsx":       "",
+		"project/reports/.ope.yml":      "allowed: [\"!draft-*\"]\n",
+		"project/reports/draft-q4.xlsx": "",
+		"project/tools/build.sh":        "",
+		"project/tools/.ope.yml":        "rules:\n  - allow if ext == \".txt\"\n",
+		"project/tools/readme.txt":      "",
+		"project/tools/deploy.sh":       "",
+		"project/broken/.ope.yml":       "blocked: [unclosed\n",
+		"project/broken/notes.md":       "",
+	}
+	for name, content := range files {
+		path := filepath.Join(tree, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config{Blocked: []string{"*.exe"}, Allowed: []string{"*.sh", "!build.sh"}}
+	tests := []struct {
+		name   string
+		action SecurityAction
+		rule   string
+	}{
+		{"project/reports/q3.xlsx", ActionAllow, "allowed: reports/ (from " + filepath.Join(tree, "project", ".ope.yml") + ")"},
+		{"project/reports/draft-q4.xlsx", ActionAsk, "default: unknown file"},
+		{"project/tools/deploy.sh", ActionBlock, "blocked: *.sh (from " + filepath.Join(tree, "project", ".ope.yml") + ")"},
+		{"project/tools/readme.txt", ActionAllow, "rule: allow if ext == \".txt\" (from " + filepath.Join(tree, "project", "tools", ".ope.yml") + ")"},
+		{"project/broken/notes.md", ActionBlock, "unreadable local policy: "},
+	}
+	for _, tt := range tests {
+		v := cfg.CheckSecurity(filepath.Join(tree, tt.name))
+		if v.Action != tt.action || !strings.HasPrefix(v.Rule, tt.rule) {
+			t.Errorf("CheckSecurity(%s) = %v %q, want %v %q", tt.name, v.Action, v.Rule, tt.action, tt.rule)
+		}
+	}
+
+	// A local file can't take back the user's own blocked entries.
+	loose := filepath.Join(tree, "project", "tools", "app.exe")
+	if err := os.WriteFile(loose, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tree, "project", "tools", ".ope.yml"), []byte("blocked: [\"!*.exe\"]\nallowed: [\"*.exe\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if v := cfg.CheckSecurity(loose); v.Action != ActionBlock || v.Rule != "blocked: *.exe" {
+		t.Errorf("CheckSecurity(app.exe) = %v %q, want block by the user's list", v.Action, v.Rule)
+	}
+
+	// Open-with rules are refused, since they would run any command; the
+	// other actions are no riskier than an allowed entry.
+	for rule, want := range map[string]SecurityAction{
+		`open-with "sh -c evil" if true`: ActionBlock,
+		"sandbox if true":                ActionSandbox,
+		"snapshot if true":               ActionSnapshot,
+	} {
+		if err := os.WriteFile(filepath.Join(tree, "project", "tools", ".ope.yml"), []byte("rules: ['"+rule+"']\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if v := cfg.CheckSecurity(filepath.Join(tree, "project", "tools", "readme.txt")); v.Action != want || v.App != "" {
+			t.Errorf("%s in .ope.yml: %v %q, want %v", rule, v.Action, v.Rule, want)
+		}
+	}
+
+	// Settings other than the policy lists are refused.
+	if err := os.WriteFile(filepath.Join(tree, "project", "tools", ".ope.yml"), []byte("silent: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if v := cfg.CheckSecurity(filepath.Join(tree, "project", "tools", "readme.txt")); v.Action != ActionBlock {
+		t.Errorf("config setting in .ope.yml: %v %q, want block", v.Action, v.Rule)
+	}
+
+	// Kiosk mode ignores local files.
+	kiosk := &Config{Mode: modeKiosk, Roots: []string{tree}}
+	if v := kiosk.CheckSecurity(filepath.Join(tree, "project", "reports", "q3.xlsx")); v.Rule != "kiosk: default: unknown file" {
+		t.Errorf("kiosk: %v %q", v.Action, v.Rule)
+	}
+}
+
+func TestLocalPolicyUntrusted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on Windows")
+	}
+	dir := t.TempDir()
+	policy := filepath.Join(dir, ".ope.yml")
+	if err := os.WriteFile(policy, []byte("root: true\nallowed: [\"*.sh\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(policy, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	policies, skipped := findLocalPolicies(filepath.Join(dir, "x.sh"))
+	for _, p := range policies {
+		if p.path == policy {
+			t.Errorf("world-writable %s was trusted", policy)
+		}
+	}
+	if len(skipped) == 0 {
+		t.Errorf("world-writable %s was not reported", policy)
+	}
+}
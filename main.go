@@ -3,15 +3,31 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	cmd := os.Args[1]
+	cmd := args[0]
+
+	// Commands that write to the user's directories don't run as root;
+	// HandleURL checks for itself, to show a dialog.
+	switch cmd {
+	case "install", "uninstall", "decisions", "test":
+		if err := checkRoot(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	switch cmd {
 	case "install":
@@ -27,19 +43,58 @@ func main() {
 		}
 
 	case "config":
-		path, err := ConfigPath()
+		path, source, err := resolveConfigPath()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Printf("Config: %s\n", path)
+		fmt.Printf("Config: %s (%s)\n", path, source)
+		if decisions, err := DecisionsPath(); err == nil {
+			fmt.Printf("Decisions: %s\n", decisions)
+		}
 		cfg, err := LoadConfig()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 			os.Exit(1)
 		}
+		fmt.Printf("Defaults: version %d\n", cfg.DefaultsVersion)
+		if cfg.Debug {
+			if log, err := DebugLogPath(); err == nil {
+				fmt.Printf("Debug log: %s\n", log)
+			}
+		}
+		if cfg.kiosk() {
+			fmt.Printf("Mode: kiosk, roots %v\n", cfg.Roots)
+			if log, err := LogPath(); err == nil {
+				fmt.Printf("Log: %s\n", log)
+			}
+		}
 		fmt.Printf("Blocked: %v\n", cfg.Blocked)
 		fmt.Printf("Allowed: %v\n", cfg.Allowed)
+		if len(cfg.BlockedHashes) > 0 {
+			fmt.Printf("Blocked hashes: %v\n", cfg.BlockedHashes)
+		}
+		for _, rule := range cfg.Rules {
+			fmt.Printf("Rule:    %s\n", rule.Source)
+		}
+
+	case "decisions":
+		if err := runDecisions(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "policy":
+		if err := runPolicy(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "explain":
+		if err := runExplain(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 	case "test":
 		fmt.Println("Creating test files...")
@@ -55,20 +110,60 @@ func main() {
 		// Treat as ope:// URL
 		if err := HandleURL(cmd); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
+		}
+	}
+}
+
+// parseGlobalFlags consumes the flags that may precede the command and
+// returns the remaining arguments.
+func parseGlobalFlags(args []string) ([]string, error) {
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--config":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("--config needs a path")
+			}
+			configFlag = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--config="):
+			configFlag = strings.TrimPrefix(args[0], "--config=")
+			args = args[1:]
+		default:
+			return args, nil
 		}
 	}
+	return args, nil
 }
 
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `ope %s — open files and folders from the browser
 
 Usage:
-  ope <ope://url>    Open a file or folder
-  ope install        Register ope:// URL scheme
-  ope uninstall      Unregister ope:// URL scheme
-  ope config         Show configuration
-  ope test           Create test files for test.html
-  ope version        Print version
+  ope <ope://url>                Open a file or folder
+  ope install                    Register ope:// URL scheme
+  ope uninstall                  Unregister ope:// URL scheme
+  ope config                     Show configuration
+  ope decisions list             List choices learned from dialogs
+  ope decisions promote <entry>  Move a learned choice into ope.yml
+  ope decisions forget <entry>   Drop a learned choice
+  ope policy keygen <name>       Create a key pair for signing policies
+  ope policy sign --key <key> <bundle>
+                                 Sign a policy bundle
+  ope policy verify [--key <pub>] <bundle>
+                                 Verify a policy bundle
+  ope policy simulate --config <file> [--history <file>]
+                                 Show which past requests a config would change
+  ope explain [--json] <url>     Show what opening a URL or path would do
+  ope test                       Create test files for test.html
+  ope version                    Print version
+
+Options:
+  --config <file>  Use this config file
+
+Environment:
+  OPE_CONFIG       Config file to use instead of the default
+  OPE_SILENT       Override the silent setting (true/false)
+  OPE_DEBUG        Override the debug setting (true/false)
 `, Version)
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -11,7 +13,13 @@ import (
 
 // ParseOpeURL extracts the local file path from an ope:// URL.
 // Supports: ope:///path, ope://localhost/path, ope://path
+// The URL and the decoded path must pass checkRawURL and sanitizePath;
+// rejections are reported as *URLError.
 func ParseOpeURL(raw string) (string, error) {
+	if err := checkRawURL(raw); err != nil {
+		return "", err
+	}
+
 	// Handle ope:path (no slashes) as ope:///path
 	if strings.HasPrefix(raw, "ope:") && !strings.HasPrefix(raw, "ope://") {
 		raw = "ope:///" + strings.TrimPrefix(raw, "ope:")
@@ -26,17 +34,22 @@ func ParseOpeURL(raw string) (string, error) {
 		return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
 	}
 
-	path := u.Host + u.Path
+	path := u.Host + u.EscapedPath()
 	if u.Host == "localhost" {
-		path = u.Path
+		path = u.EscapedPath()
 	}
 
-	// URL-decode the path
+	// URL-decode the path, exactly once
 	path, err = url.PathUnescape(path)
 	if err != nil {
 		return "", fmt.Errorf("invalid path encoding: %w", err)
 	}
 
+	path, err = sanitizePath(path)
+	if err != nil {
+		return "", err
+	}
+
 	// Windows drive letter: /C:/... → C:/...
 	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
 		path = path[1:]
@@ -45,8 +58,50 @@ func ParseOpeURL(raw string) (string, error) {
 	return path, nil
 }
 
+// URLMode returns the mode parameter of an ope:// URL, which asks for the
+// file to be opened a particular way: "" for a normal open or modeSnapshot.
+// A mode can only make opening safer; it never gets past the policy.
+func URLMode(raw string) (string, error) {
+	if strings.HasPrefix(raw, "ope:") && !strings.HasPrefix(raw, "ope://") {
+		raw = "ope:///" + strings.TrimPrefix(raw, "ope:")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	switch mode := u.Query().Get("mode"); mode {
+	case "", modeSnapshot:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported mode: %q", mode)
+	}
+}
+
+// expandHome replaces a leading ~ with the home directory. The path is
+// returned unchanged if the home directory cannot be determined.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
 // ExpandPath handles tilde expansion and glob patterns.
 func ExpandPath(path string) (string, error) {
+	return expandPath(path, nil)
+}
+
+// expandPath is ExpandPath, calling trace (if not nil) after every step that
+// changed the path.
+func expandPath(path string, trace func(step, result string)) (string, error) {
+	if trace == nil {
+		trace = func(string, string) {}
+	}
+
 	// Tilde expansion
 	if strings.HasPrefix(path, "~") {
 		home, err := os.UserHomeDir()
@@ -54,6 +109,7 @@ func ExpandPath(path string) (string, error) {
 			return "", fmt.Errorf("cannot expand ~: %w", err)
 		}
 		path = filepath.Join(home, path[1:])
+		trace("tilde", path)
 	}
 
 	// Glob expansion — if the path contains wildcards, resolve them
@@ -67,18 +123,115 @@ func ExpandPath(path string) (string, error) {
 		}
 		// Use the first match
 		path = matches[0]
+		trace(fmt.Sprintf("glob (first of %d matches)", len(matches)), path)
+	}
+
+	if clean := filepath.Clean(path); clean != path {
+		path = clean
+		trace("clean", path)
+	}
+	return path, nil
+}
+
+// openPath launches the platform's default application for path, with
+// the environment env (ope's own if nil).
+func openPath(path string, env []string) error {
+	args, err := openerCommand(path)
+	if err != nil {
+		return err
+	}
+	return runWithEnv(args, env)
+}
+
+// runWithEnv runs a command with the environment env, ope's if nil.
+func runWithEnv(args, env []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	return cmd.Run()
+}
+
+// openSandboxed launches the default application for path inside a
+// sandbox. There is no fallback: if the sandbox can't be set up, the file
+// isn't opened.
+func openSandboxed(path string, env []string) error {
+	args, err := sandboxCommand(path)
+	if err != nil {
+		return err
+	}
+	return runWithEnv(args, env)
+}
+
+// openWith launches app for path; see openWithCommand.
+func openWith(path, app string, env []string) error {
+	args, err := openWithCommand(path, app)
+	if err != nil {
+		return err
+	}
+	return runWithEnv(args, env)
+}
+
+// revealPath shows path in the file manager without opening it.
+func revealPath(path string, env []string) error {
+	args, err := revealCommand(path)
+	if err != nil {
+		return err
+	}
+	err = runWithEnv(args, env)
+	var exitErr *exec.ExitError
+	if runtime.GOOS == "windows" && errors.As(err, &exitErr) {
+		// explorer exits with 1 even when it worked.
+		return nil
+	}
+	return err
+}
+
+// copyPath puts path on the clipboard.
+func copyPath(path string, env []string) error {
+	args, err := clipboardCommand()
+	if err != nil {
+		return err
 	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(path)
+	return cmd.Run()
+}
 
-	return filepath.Clean(path), nil
+// blockedMessage is the text of the dialog shown for a blocked path.
+func blockedMessage(path string, v Verdict) string {
+	return fmt.Sprintf("Blocked by security policy: %s\n\n%s", visibleName(filepath.Base(path)), v.Rule)
 }
 
 // HandleURL is the main entry point: parse URL, expand path, check security, open.
-func HandleURL(raw string) error {
+func HandleURL(raw string) (err error) {
+	if err := checkRoot(); err != nil {
+		showErrorDialog("Running as Root", err.Error())
+		return err
+	}
+
+	// In kiosk mode every request is logged, including ones that fail
+	// before the config is loaded.
+	var cfg *Config
+	var checked *Verdict
+	defer func() {
+		if cfg == nil {
+			cfg, _ = LoadConfig()
+		}
+		if cfg != nil && cfg.kiosk() {
+			_ = logRequest(raw, checked, err)
+		}
+	}()
+
 	path, err := ParseOpeURL(raw)
 	if err != nil {
 		showErrorDialog("Invalid URL", err.Error())
 		return err
 	}
+	mode, err := URLMode(raw)
+	if err != nil {
+		showErrorDialog("Invalid URL", err.Error())
+		return err
+	}
 
 	path, err = ExpandPath(path)
 	if err != nil {
@@ -86,17 +239,39 @@ func HandleURL(raw string) error {
 		return err
 	}
 
-	cfg, err := LoadConfig()
+	cfg, err = LoadConfig()
 	if err != nil {
-		showErrorDialog("Config Error", err.Error())
+		var insecure *InsecureConfigError
+		if errors.As(err, &insecure) {
+			showErrorDialog("Insecure Config", err.Error())
+		} else {
+			showErrorDialog("Config Error", err.Error())
+		}
 		return err
 	}
+	_ = cleanSnapshots(cfg.SnapshotRetention)
+
+	// Pin the file first so that every check below, and the final open, is
+	// about the same file even if the path is swapped in the meantime.
+	pin, pinErr := pinFile(path)
+	if pinErr == nil {
+		defer pin.Close()
+	}
 
 	// Check security policy before checking existence — blocking is a policy
 	// decision that doesn't need the file to exist.
-	action := cfg.CheckSecurity(path)
-	if action == ActionBlock {
-		msg := fmt.Sprintf("Blocked by security policy: %s", filepath.Base(path))
+	verdict := cfg.checkPinned(path, pin)
+	if cfg.Scanner != nil && pinErr == nil {
+		verdict = cfg.Scanner.apply(verdict, pin)
+		// Kiosk mode shows no dialog for an unscanned file either.
+		if cfg.kiosk() && verdict.Action == ActionAsk {
+			verdict.Action, verdict.Rule = ActionBlock, "kiosk: "+verdict.Rule
+		}
+	}
+	checked = &verdict
+	_ = recordHistory(raw, verdict)
+	if verdict.Action == ActionBlock {
+		msg := blockedMessage(path, verdict)
 		if cfg.Silent {
 			return nil
 		}
@@ -105,36 +280,115 @@ func HandleURL(raw string) error {
 	}
 
 	// Check that path exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if pinErr != nil {
 		if cfg.Silent {
 			return nil
 		}
-		msg := fmt.Sprintf("Path does not exist: %s", path)
-		showErrorDialog("Not Found", msg)
-		return fmt.Errorf("path does not exist: %s", path)
+		if os.IsNotExist(pinErr) {
+			msg := fmt.Sprintf("Path does not exist: %s", path)
+			showErrorDialog("Not Found", msg)
+			return fmt.Errorf("path does not exist: %s", path)
+		}
+		showErrorDialog("Open Error", pinErr.Error())
+		return pinErr
+	}
+
+	// Applications get a cleaned-up environment, not the browser's.
+	env := cfg.openerEnv()
+
+	// Open the resolved target, not the link: the policy decision was made
+	// for the target, and the link could be repointed in the meantime.
+	target := verdict.Target
+	verify := func() error {
+		err := pin.verify(target)
+		if err != nil && !cfg.Silent {
+			showErrorDialog("File Changed", err.Error())
+		}
+		return err
+	}
+	openTarget := func(action SecurityAction) error {
+		if err := verify(); err != nil {
+			return err
+		}
+		file := target
+		if action == ActionSnapshot || mode == modeSnapshot {
+			snapshot, err := takeSnapshot(target, pin)
+			if err != nil {
+				if !cfg.Silent {
+					showErrorDialog("Snapshot Error", err.Error())
+				}
+				return err
+			}
+			file = snapshot
+		}
+		if action == ActionOpenWith {
+			return openWith(file, verdict.App, env)
+		}
+		return openPath(file, env)
 	}
 
-	switch action {
-	case ActionAllow:
-		return openPath(path)
+	// carryOut does what action says, for a verdict that needs no dialog
+	// or after the dialog.
+	carryOut := func(action SecurityAction) error {
+		switch action {
+		case ActionAllow, ActionSnapshot, ActionOpenWith:
+			return openTarget(action)
+
+		case ActionReveal:
+			if err := verify(); err != nil {
+				return err
+			}
+			if err := revealPath(target, env); err != nil {
+				if !cfg.Silent {
+					showErrorDialog("Reveal Error", err.Error())
+				}
+				return err
+			}
+			return nil
+
+		case ActionCopyPath:
+			if err := copyPath(target, env); err != nil {
+				if !cfg.Silent {
+					showErrorDialog("Clipboard Error", err.Error())
+				}
+				return err
+			}
+			return nil
 
-	case ActionAsk:
-		result := showConfirmDialog(path)
-		switch result {
-		case ConfirmAllow:
-			return openPath(path)
-		case ConfirmAlways:
-			cfg.Allowed = append(cfg.Allowed, filepath.Base(path))
-			_ = SaveConfig(cfg)
-			return openPath(path)
-		case ConfirmBlock:
-			cfg.Blocked = append(cfg.Blocked, filepath.Base(path))
-			_ = SaveConfig(cfg)
-			return fmt.Errorf("blocked: %s", filepath.Base(path))
-		default:
-			return fmt.Errorf("cancelled")
+		case ActionSandbox:
+			if err := verify(); err != nil {
+				return err
+			}
+			if err := openSandboxed(target, env); err != nil {
+				if !cfg.Silent {
+					showErrorDialog("Sandbox Error", err.Error())
+				}
+				return err
+			}
+			return nil
 		}
+		return nil
+	}
+
+	if verdict.Action != ActionAsk && verdict.Action != ActionAskAlways {
+		return carryOut(verdict.Action)
 	}
 
-	return nil
+	// ask-always offers no "Always Allow" and remembers no answer.
+	remember := verdict.Action == ActionAsk
+	result := showConfirmDialog(confirmMessage(path, verdict), remember)
+	switch result {
+	case ConfirmAllow:
+		return carryOut(verdict.Then)
+	case ConfirmAlways:
+		_ = RecordDecision(true, allowEntry(target, pin))
+		return carryOut(verdict.Then)
+	case ConfirmBlock:
+		if remember {
+			_ = RecordDecision(false, filepath.Base(target))
+		}
+		return fmt.Errorf("blocked: %s", filepath.Base(target))
+	default:
+		return fmt.Errorf("cancelled")
+	}
 }
@@ -2,8 +2,23 @@
 
 package main
 
-import "os/exec"
+func openerCommand(path string) ([]string, error) {
+	return []string{"open", path}, nil
+}
+
+// revealCommand shows path selected in the Finder.
+func revealCommand(path string) ([]string, error) {
+	return []string{"open", "-R", path}, nil
+}
+
+// clipboardCommand returns a command that puts its standard input on the
+// clipboard.
+func clipboardCommand() ([]string, error) {
+	return []string{"pbcopy"}, nil
+}
 
-func openPath(path string) error {
-	return exec.Command("open", path).Run()
+// openWithCommand returns the command that opens path with app, an
+// application name or path as open -a takes it, e.g. "Preview".
+func openWithCommand(path, app string) ([]string, error) {
+	return []string{"open", "-a", app, path}, nil
 }
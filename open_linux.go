@@ -2,8 +2,70 @@
 
 package main
 
-import "os/exec"
+import (
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
 
-func openPath(path string) error {
-	return exec.Command("xdg-open", path).Run()
+func openerCommand(path string) ([]string, error) {
+	return []string{"xdg-open", path}, nil
+}
+
+// revealCommand asks the file manager to show path selected, through the
+// org.freedesktop.FileManager1 D-Bus interface. Without dbus-send it opens
+// the containing directory instead.
+func revealCommand(path string) ([]string, error) {
+	if _, err := exec.LookPath("dbus-send"); err != nil {
+		return []string{"xdg-open", filepath.Dir(path)}, nil
+	}
+	// dbus-send separates array items with commas.
+	uri := strings.ReplaceAll((&url.URL{Scheme: "file", Path: path}).String(), ",", "%2C")
+	return []string{"dbus-send", "--session", "--print-reply",
+		"--dest=org.freedesktop.FileManager1", "/org/freedesktop/FileManager1",
+		"org.freedesktop.FileManager1.ShowItems", "array:string:" + uri, "string:"}, nil
+}
+
+// clipboardCommand returns a command that puts its standard input on the
+// clipboard: wl-copy on Wayland, xclip or xsel on X11.
+func clipboardCommand() ([]string, error) {
+	candidates := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append([][]string{{"wl-copy"}}, candidates...)
+	}
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return args, nil
+		}
+	}
+	return nil, errors.New("no clipboard tool found: install wl-clipboard, xclip or xsel")
+}
+
+// openWithCommand returns the command that opens path with app, which is
+// either a desktop file ID such as "org.gnome.Evince.desktop" or a command
+// line in the same syntax as a desktop file's Exec key.
+func openWithCommand(path, app string) ([]string, error) {
+	if !strings.HasSuffix(app, ".desktop") {
+		return expandExec(app, path)
+	}
+	desktop, err := findDesktopFile(app)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(desktop)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := desktopExec(f)
+	if err != nil {
+		return nil, err
+	}
+	return expandExec(line, path)
 }
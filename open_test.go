@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseOpeURL(t *testing.T) {
@@ -106,7 +111,7 @@ func TestCheckSecurity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := cfg.CheckSecurity(tt.path)
+			got := cfg.CheckSecurity(tt.path).Action
 			if got != tt.want {
 				t.Errorf("CheckSecurity(%q) = %v, want %v", tt.path, got, tt.want)
 			}
@@ -121,7 +126,7 @@ func TestCheckSecurityDirectory(t *testing.T) {
 	}
 
 	dir := t.TempDir()
-	got := cfg.CheckSecurity(dir)
+	got := cfg.CheckSecurity(dir).Action
 	if got != ActionAllow {
 		t.Errorf("CheckSecurity(dir) = %v, want ActionAllow", got)
 	}
@@ -136,3 +141,315 @@ func TestDefaultConfig(t *testing.T) {
 		t.Error("DefaultConfig should have empty allowed list")
 	}
 }
+
+func TestMatchEntryOrigin(t *testing.T) {
+	origin := &Origin{URL: "https://dl.Example.com/files/report.pdf"}
+
+	tests := []struct {
+		pattern string
+		origin  *Origin
+		want    bool
+	}{
+		{"origin:*.example.com", origin, true},
+		{"origin:dl.example.com", origin, true},
+		{"origin:example.org", origin, false},
+		{"origin:*.example.com", nil, false},
+		{"*.pdf", origin, true},
+	}
+
+	for _, tt := range tests {
+		if got := matchEntry(tt.pattern, "report.pdf", tt.origin); got != tt.want {
+			t.Errorf("matchEntry(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSecuritySymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "install.sh")
+	hop := filepath.Join(dir, "notes.md")
+	link := filepath.Join(dir, "readme.txt")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("install.sh", hop); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(hop, link); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		Blocked: []string{"*.sh"},
+		Allowed: []string{"*.txt"},
+	}
+	v := cfg.CheckSecurity(link)
+	if v.Action != ActionBlock {
+		t.Errorf("link to blocked file: got %v (%s), want ActionBlock", v.Action, v.Rule)
+	}
+	resolved, _ := filepath.EvalSymlinks(script)
+	if v.Target != resolved {
+		t.Errorf("Target = %q, want %q", v.Target, resolved)
+	}
+
+	// A blocked intermediate hop blocks too.
+	cfg.Blocked = []string{"*.md"}
+	cfg.Allowed = []string{"*.txt", "*.sh"}
+	if got := cfg.CheckSecurity(link).Action; got != ActionBlock {
+		t.Errorf("link via blocked hop: got %v, want ActionBlock", got)
+	}
+
+	// An allowed link name does not allow an unknown target.
+	cfg.Blocked = nil
+	cfg.Allowed = []string{"*.txt"}
+	if got := cfg.CheckSecurity(link).Action; got != ActionAsk {
+		t.Errorf("allowed link to unknown target: got %v, want ActionAsk", got)
+	}
+}
+
+func TestPinnedFileVerify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(path, []byte("original"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pin, err := pinFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Close()
+
+	if err := pin.verify(path); err != nil {
+		t.Errorf("verify unchanged file: %v", err)
+	}
+
+	// Replace the file with a different one under the same name.
+	swap := filepath.Join(dir, "swap.txt")
+	if err := os.WriteFile(swap, []byte("malicious"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(swap, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pin.verify(path); !errors.Is(err, ErrFileChanged) {
+		t.Errorf("verify swapped file: got %v, want ErrFileChanged", err)
+	}
+}
+
+func TestMergeDefaults(t *testing.T) {
+	var cfg Config
+	data := `
+blocked: ["*.exe", "*.custom"]
+allowed: ["*.py"]
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.mergeDefaults("linux")
+
+	if !containsFold(cfg.Blocked, "*.custom") || !containsFold(cfg.Blocked, "*.exe") {
+		t.Errorf("user entries lost: %v", cfg.Blocked)
+	}
+	if !containsFold(cfg.Blocked, "*.desktop") || !containsFold(cfg.Blocked, "*.sh") {
+		t.Errorf("new linux defaults not merged: %v", cfg.Blocked)
+	}
+	if containsFold(cfg.Blocked, "*.py") {
+		t.Errorf("allowed entry was re-blocked: %v", cfg.Blocked)
+	}
+	if containsFold(cfg.Blocked, "*.bat") {
+		t.Errorf("version 1 default re-added to a pre-versioning config: %v", cfg.Blocked)
+	}
+	if containsFold(cfg.Blocked, "*.command") {
+		t.Errorf("macOS default merged on linux: %v", cfg.Blocked)
+	}
+	if cfg.DefaultsVersion != defaultsVersion {
+		t.Errorf("DefaultsVersion = %d, want %d", cfg.DefaultsVersion, defaultsVersion)
+	}
+
+	// A default the user takes back with "!" isn't added after that.
+	cfg = Config{Blocked: []string{"*.exe", "!*.py"}}
+	cfg.mergeDefaults("linux")
+	if pattern, _ := matchList(cfg.Blocked, "", candidate{path: "/tmp/x.py", isDir: func() bool { return false }}); pattern != "" {
+		t.Errorf("negated default re-blocked: %v", cfg.Blocked)
+	}
+
+	// Once recorded, removed defaults stay removed.
+	cfg.Blocked = []string{"*.exe"}
+	cfg.mergeDefaults("linux")
+	if len(cfg.Blocked) != 1 {
+		t.Errorf("up-to-date config changed: %v", cfg.Blocked)
+	}
+}
+
+func TestDecisions(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	if err := RecordDecision(true, "notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordDecision(false, "tool.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordDecision(true, "notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDecisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Allowed) != 1 || d.Allowed[0] != "notes.txt" || len(d.Blocked) != 1 {
+		t.Fatalf("decisions = %+v", d)
+	}
+
+	allowed, found := d.remove("tool.bin")
+	if !found || allowed {
+		t.Errorf("remove(tool.bin) = %v, %v, want false, true", allowed, found)
+	}
+	if _, found := d.remove("tool.bin"); found {
+		t.Error("removed entry still present")
+	}
+}
+
+func TestPromoteDecision(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": "# synced between machines\nsilent: true # no dialogs\nallowed: [\"*.md\"]\n",
+	})
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	if err := RecordDecision(true, "notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordDecision(false, "tool.bin"); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{"notes.txt", "tool.bin"} {
+		if err := runDecisions([]string{"promote", entry}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "ope.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# synced between machines", "silent: true # no dialogs", `allowed: ["*.md", notes.txt]`, "- tool.bin"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("promoted config lacks %q:\n%s", want, data)
+		}
+	}
+	// Nothing specific to this machine is written.
+	for _, unwanted := range []string{"defaults_version", "*.desktop", "*.command", "*.lnk"} {
+		if strings.Contains(string(data), unwanted) {
+			t.Errorf("promoted config has %q:\n%s", unwanted, data)
+		}
+	}
+
+	// The built-in blocklist still applies in full.
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{"*.exe", "tool.bin"} {
+		if !slices.Contains(cfg.Blocked, entry) {
+			t.Errorf("Blocked = %v, want %s in it", cfg.Blocked, entry)
+		}
+	}
+	if runtime.GOOS == "linux" && !slices.Contains(cfg.Blocked, "*.desktop") {
+		t.Errorf("Blocked = %v, want the linux defaults in it", cfg.Blocked)
+	}
+}
+
+func TestConfigPathOverrides(t *testing.T) {
+	dir := t.TempDir()
+	t.Cleanup(func() { configFlag = "" })
+
+	t.Setenv("OPE_CONFIG", filepath.Join(dir, "env.yml"))
+	path, source, err := resolveConfigPath()
+	if err != nil || path != filepath.Join(dir, "env.yml") || source != "OPE_CONFIG" {
+		t.Errorf("OPE_CONFIG: got %q %q %v", path, source, err)
+	}
+
+	args, err := parseGlobalFlags([]string{"--config", filepath.Join(dir, "flag.yml"), "config"})
+	if err != nil || len(args) != 1 || args[0] != "config" {
+		t.Fatalf("parseGlobalFlags: %v %v", args, err)
+	}
+	path, source, _ = resolveConfigPath()
+	if path != filepath.Join(dir, "flag.yml") || source != "--config" {
+		t.Errorf("--config: got %q %q", path, source)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{"OPE_SILENT": "true"}
+	getenv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := DefaultConfig()
+	if err := cfg.applyEnv(getenv); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Silent {
+		t.Error("OPE_SILENT=true not applied")
+	}
+
+	env["OPE_SILENT"] = "maybe"
+	if err := cfg.applyEnv(getenv); err == nil {
+		t.Error("invalid OPE_SILENT accepted")
+	}
+}
+
+func TestCheckFilePerms(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission checks are Unix-only")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ope.yml")
+	if err := os.WriteFile(path, []byte("silent: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilePerms(path, false); err != nil {
+		t.Errorf("private file: %v", err)
+	}
+
+	var insecure *InsecureConfigError
+	if err := os.Chmod(path, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilePerms(path, true); !errors.As(err, &insecure) {
+		t.Errorf("world-writable file: got %v, want InsecureConfigError", err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0o700)
+	if err := checkFilePerms(path, false); !errors.As(err, &insecure) {
+		t.Errorf("world-writable directory: got %v, want InsecureConfigError", err)
+	}
+
+	configFlag = path
+	t.Cleanup(func() { configFlag = "" })
+	if _, err := loadConfigFile(); !errors.As(err, &insecure) {
+		t.Errorf("loadConfigFile: got %v, want InsecureConfigError", err)
+	}
+
+	// Like /tmp: others can't replace a file they don't own.
+	if err := os.Chmod(dir, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilePerms(path, false); err != nil {
+		t.Errorf("sticky directory: %v", err)
+	}
+}
@@ -2,18 +2,33 @@
 
 package main
 
-import (
-	"os"
-	"os/exec"
-)
+import "os"
 
-func openPath(path string) error {
+func openerCommand(path string) ([]string, error) {
 	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if info.IsDir() {
-		return exec.Command("explorer", path).Run()
+		return []string{"explorer", path}, nil
 	}
-	return exec.Command("cmd", "/c", "start", "", path).Run()
+	return []string{"cmd", "/c", "start", "", path}, nil
+}
+
+// revealCommand shows path selected in Explorer.
+func revealCommand(path string) ([]string, error) {
+	return []string{"explorer", "/select," + path}, nil
+}
+
+// clipboardCommand returns a command that puts its standard input, read as
+// UTF-8, on the clipboard. clip.exe would need UTF-16.
+func clipboardCommand() ([]string, error) {
+	return []string{"powershell", "-NoProfile", "-Command",
+		"[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"}, nil
+}
+
+// openWithCommand returns the command that opens path with app, the path
+// or name of an executable.
+func openWithCommand(path, app string) ([]string, error) {
+	return []string{app, path}, nil
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Origin describes where a downloaded file came from, as recorded by the
+// browser that saved it.
+type Origin struct {
+	URL      string
+	Referrer string
+}
+
+// Host returns the lowercased host of the origin URL, falling back to the
+// referrer when the download URL is missing or unparsable.
+func (o *Origin) Host() string {
+	for _, raw := range []string{o.URL, o.Referrer} {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	return ""
+}
+
+// Source returns a human-readable description of the origin for dialogs.
+// The URLs come from file metadata that whoever saved the file controls, so
+// they go through visibleName like file names do.
+func (o *Origin) Source() string {
+	switch {
+	case o.URL != "":
+		return visibleName(o.URL)
+	case o.Referrer != "":
+		return visibleName(o.Referrer)
+	default:
+		return "the internet"
+	}
+}
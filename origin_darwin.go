@@ -0,0 +1,9 @@
+//go:build darwin
+
+package main
+
+// readOrigin is not implemented on macOS yet: the download URL lives in the
+// kMDItemWhereFroms attribute as a binary plist.
+func readOrigin(path string, pin *pinnedFile) *Origin {
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// readOrigin returns the download origin stored by Chromium and Firefox in the
+// user.xdg.origin.url / user.xdg.referrer.url extended attributes. They are
+// read from pin if it is not nil, so that they belong to the file that gets
+// opened.
+func readOrigin(path string, pin *pinnedFile) *Origin {
+	o := &Origin{
+		URL:      getxattr(path, pin, "user.xdg.origin.url"),
+		Referrer: getxattr(path, pin, "user.xdg.referrer.url"),
+	}
+	if o.URL == "" && o.Referrer == "" {
+		return nil
+	}
+	return o
+}
+
+func getxattr(path string, pin *pinnedFile, name string) string {
+	get := func(buf []byte) (int, error) { return syscall.Getxattr(path, name, buf) }
+	if pin != nil {
+		get = func(buf []byte) (int, error) { return fgetxattr(pin.file.Fd(), name, buf) }
+	}
+	size, err := get(nil)
+	if err != nil || size <= 0 {
+		return ""
+	}
+	buf := make([]byte, size)
+	size, err = get(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:size])
+}
+
+// fgetxattr is getxattr(2) on an open file, which the syscall package lacks.
+func fgetxattr(fd uintptr, name string, buf []byte) (int, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	var data unsafe.Pointer
+	if len(buf) > 0 {
+		data = unsafe.Pointer(&buf[0])
+	}
+	n, _, errno := syscall.Syscall6(syscall.SYS_FGETXATTR, fd, uintptr(unsafe.Pointer(p)), uintptr(data), uintptr(len(buf)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCheckSecurityDownloadOrigin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "document.pdf")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(path, "user.xdg.origin.url", []byte("https://evil.example.net/document.pdf"), 0); err != nil {
+		t.Skipf("user xattrs not supported: %v", err)
+	}
+
+	cfg := &Config{Allowed: []string{"*.pdf"}}
+	v := cfg.CheckSecurity(path)
+	if v.Action != ActionAsk {
+		t.Errorf("downloaded allowlisted file: got %v, want ActionAsk", v.Action)
+	}
+	if v.Origin == nil || v.Origin.Host() != "evil.example.net" {
+		t.Errorf("origin = %+v, want host evil.example.net", v.Origin)
+	}
+
+	cfg.Allowed = append(cfg.Allowed, "origin:*.example.net")
+	if got := cfg.CheckSecurity(path).Action; got != ActionAllow {
+		t.Errorf("allowlisted origin: got %v, want ActionAllow", got)
+	}
+
+	cfg.Blocked = []string{"origin:evil.*"}
+	if got := cfg.CheckSecurity(path).Action; got != ActionBlock {
+		t.Errorf("blocked origin: got %v, want ActionBlock", got)
+	}
+}
+
+func TestCheckSecurityDownloadOriginRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(path, "user.xdg.origin.url", []byte("https://evil.example.net/document.pdf"), 0); err != nil {
+		t.Skipf("user xattrs not supported: %v", err)
+	}
+
+	// Rules that open a downloaded file still ask first, and the dialog
+	// leads to what the rule said.
+	for _, tt := range []struct {
+		rule string
+		then SecurityAction
+	}{
+		{`allow if ext == ".pdf"`, ActionAllow},
+		{`sandbox if origin != ""`, ActionSandbox},
+		{`open-with "evince" if ext == ".pdf"`, ActionOpenWith},
+	} {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &Config{Rules: []Rule{rule}}
+		v := cfg.CheckSecurity(path)
+		if v.Action != ActionAsk || v.Then != tt.then {
+			t.Errorf("%s: got %v then %v (%s), want ask then %v", tt.rule, v.Action, v.Then, v.Rule, tt.then)
+		}
+
+		cfg.Allowed = []string{"origin:*.example.net"}
+		if v := cfg.CheckSecurity(path); v.Action != tt.then {
+			t.Errorf("%s with an allowed origin: got %v, want %v", tt.rule, v.Action, tt.then)
+		}
+	}
+
+	// So do rules in a .ope.yml.
+	local := `rules: ['allow if ext == ".pdf"']`
+	if err := os.WriteFile(filepath.Join(dir, localPolicyName), []byte(local), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v := (&Config{}).CheckSecurity(path); v.Action != ActionAsk {
+		t.Errorf("local allow rule: got %v %q, want ask", v.Action, v.Rule)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readOrigin parses the Zone.Identifier alternate data stream that browsers
+// attach to downloaded files. Streams can only be opened by name, so it is
+// read from path even when the file is pinned.
+func readOrigin(path string, pin *pinnedFile) *Origin {
+	f, err := os.Open(path + ":Zone.Identifier")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	o := &Origin{}
+	zone := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ZoneId":
+			zone, _ = strconv.Atoi(value)
+		case "HostUrl":
+			o.URL = value
+		case "ReferrerUrl":
+			o.Referrer = value
+		}
+	}
+
+	// Zones 3 (Internet) and 4 (Restricted) mark untrusted downloads.
+	if zone < 3 && o.URL == "" && o.Referrer == "" {
+		return nil
+	}
+	return o
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pathPattern is a blocked/allowed entry with gitignore semantics, matched
+// against the full path instead of the base name:
+//   - "**" matches any number of directories: "**/node_modules/**"
+//   - a trailing "/" matches directories only: "build/"
+//   - a leading "/" or "~/" anchors the pattern: "~/Downloads/**"
+//   - other patterns match at any depth: "src/*.sh" matches /a/src/x.sh
+//   - a pattern matching a directory also matches everything inside it
+//
+// Negation with "!" is handled by matchList, for path patterns and base name
+// globs alike.
+type pathPattern struct {
+	segments []string
+	dirOnly  bool
+}
+
+// isPathPattern reports whether an entry is a path pattern rather than a
+// base name glob.
+func isPathPattern(entry string) bool {
+	return strings.Contains(filepath.ToSlash(entry), "/") || strings.Contains(entry, "**")
+}
+
+// cutNegation strips a leading "!" and reports whether it was there. A
+// leading "\!" stands for a literal "!".
+func cutNegation(entry string) (string, bool) {
+	if rest, ok := strings.CutPrefix(entry, "!"); ok {
+		return rest, true
+	}
+	if rest, ok := strings.CutPrefix(entry, `\!`); ok {
+		return "!" + rest, false
+	}
+	return entry, false
+}
+
+// compilePathPattern compiles entry. If base is not empty, the pattern is
+// relative to that directory as in a .gitignore file: it is anchored there
+// when it contains a "/" other than a trailing one. Otherwise only a leading
+// "/" anchors it, at the filesystem root. A leading "~/" or drive letter
+// always anchors it there.
+func compilePathPattern(entry, base string) pathPattern {
+	var p pathPattern
+	anchored := filepath.VolumeName(entry) != "" || strings.HasPrefix(entry, "~")
+	entry = expandHome(entry)
+	entry = strings.ToLower(filepath.ToSlash(entry))
+	if trimmed := strings.TrimSuffix(entry, "/"); trimmed != entry {
+		entry, p.dirOnly = trimmed, true
+	}
+
+	if base != "" && !anchored {
+		if !strings.Contains(entry, "/") {
+			entry = "**/" + entry
+		}
+		base = strings.TrimSuffix(strings.ToLower(filepath.ToSlash(filepath.Clean(base))), "/")
+		entry = base + "/" + strings.TrimPrefix(entry, "/")
+		anchored = true
+	} else if strings.HasPrefix(entry, "/") {
+		anchored = true
+	}
+
+	p.segments = strings.Split(strings.TrimPrefix(entry, "/"), "/")
+	if !anchored && p.segments[0] != "**" {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	return p
+}
+
+// match reports whether the pattern matches path or one of its parent
+// directories. isDir is only called for directory-only patterns.
+func (p pathPattern) match(name string, isDir func() bool) bool {
+	name = strings.ToLower(filepath.ToSlash(filepath.Clean(name)))
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for n := 1; n <= len(parts); n++ {
+		if !matchSegments(p.segments, parts[:n]) {
+			continue
+		}
+		if n < len(parts) || !p.dirOnly || isDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches pattern segments against path components. A "**"
+// matches zero or more components, except at the end where it needs at
+// least one, so that "dir/**" matches what is inside dir but not dir.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// isDirFunc returns a function reporting whether path is a directory,
+// calling stat at most once.
+func isDirFunc(path string) func() bool {
+	return sync.OnceValue(func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.IsDir()
+	})
+}
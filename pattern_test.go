@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathPattern(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"**/node_modules/**", "/src/app/node_modules/left-pad/index.js", false, true},
+		{"**/node_modules/**", "/src/app/node_modules", true, false},
+		{"**/node_modules/**", "/src/app/main.js", false, false},
+		{"node_modules/", "/src/app/node_modules/x/y.js", false, true},
+		{"node_modules/", "/src/app/node_modules", true, true},
+		{"node_modules/", "/src/app/node_modules", false, false},
+		{"src/*.sh", "/home/me/src/x.sh", false, true},
+		{"src/*.sh", "/home/me/src/lib/x.sh", false, false},
+		{"/src/*.sh", "/home/me/src/x.sh", false, false},
+		{"/home/*/src/*.sh", "/home/me/src/x.sh", false, true},
+		{"/srv/**", "/srv", true, false},
+		{"/srv/**", "/srv/a/b/c", false, true},
+		{"/srv/*", "/srv/a/b/c", false, true},
+		{"/SRV/Share/**", "/srv/share/x", false, true},
+		{"a/**/b", "/x/a/b", false, true},
+		{"a/**/b", "/x/a/1/2/b", false, true},
+		{"~/Downloads/*.html", filepath.Join(home, "Downloads", "x.html"), false, true},
+		{"~/Downloads/*.html", "/tmp/Downloads/x.html", false, false},
+	}
+	for _, tt := range tests {
+		got := compilePathPattern(tt.pattern, "").match(tt.path, func() bool { return tt.isDir })
+		if got != tt.want {
+			t.Errorf("%q match %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestPathPatternBase(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.sh", "/repo/a/b/x.sh", true},
+		{"*.sh", "/other/x.sh", false},
+		{"/build", "/repo/build/out.bin", true},
+		{"/build", "/repo/a/build/out.bin", false},
+		{"a/*.sh", "/repo/a/x.sh", true},
+		{"a/*.sh", "/repo/b/a/x.sh", false},
+	}
+	for _, tt := range tests {
+		got := compilePathPattern(tt.pattern, "/repo").match(tt.path, func() bool { return false })
+		if got != tt.want {
+			t.Errorf("%q in /repo match %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchListNegation(t *testing.T) {
+	notDir := func() bool { return false }
+	tests := []struct {
+		list []string
+		path string
+		want string
+	}{
+		{[]string{"*.sh", "!deploy.sh"}, "/x/deploy.sh", ""},
+		{[]string{"*.sh", "!deploy.sh"}, "/x/build.sh", "*.sh"},
+		{[]string{"*.sh", "!deploy.sh", "/srv/**"}, "/srv/deploy.sh", "/srv/**"},
+		{[]string{"!deploy.sh", "*.sh"}, "/x/deploy.sh", "*.sh"},
+		{[]string{"/srv/**", "!/srv/public/"}, "/srv/public/index.html", ""},
+		{[]string{`\!bang.txt`}, "/x/!bang.txt", `\!bang.txt`},
+	}
+	for _, tt := range tests {
+		if got, _ := matchList(tt.list, "", candidate{path: tt.path, isDir: notDir}); got != tt.want {
+			t.Errorf("matchList(%q, %q) = %q, want %q", tt.list, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSecurityPathPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"node_modules/pkg/run.txt", "deploy.sh", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config{
+		Blocked: []string{"**/node_modules/**", "*.sh", "!deploy.sh"},
+		Allowed: []string{filepath.ToSlash(dir) + "/*"},
+	}
+	tests := []struct {
+		name   string
+		action SecurityAction
+	}{
+		{"node_modules/pkg/run.txt", ActionBlock},
+		{"deploy.sh", ActionAllow},
+		{"notes.txt", ActionAllow},
+	}
+	for _, tt := range tests {
+		if v := cfg.CheckSecurity(filepath.Join(dir, tt.name)); v.Action != tt.action {
+			t.Errorf("CheckSecurity(%s) = %v (%s), want %v", tt.name, v.Action, v.Rule, tt.action)
+		}
+	}
+}
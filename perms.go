@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// InsecureConfigError reports a config file that someone other than the
+// user could have modified, and how to fix it.
+type InsecureConfigError struct {
+	Path    string
+	Problem string
+	Fix     string
+}
+
+func (e *InsecureConfigError) Error() string {
+	return fmt.Sprintf("refusing to load %s: %s\n\nTo fix, run:\n  %s", e.Path, e.Problem, e.Fix)
+}
+
+// checkFilePerms refuses files that someone other than the user or root may
+// have written, like ssh does for its config: the file or its directory is
+// group or world writable, or owned by another user. With otherOwnerOK,
+// files and directories owned by other users are accepted as long as they
+// aren't writable by group or others, e.g. for a read-only team share.
+// A sticky directory like /tmp may be writable by others, since they can't
+// replace a file they don't own there. Missing files pass; the check is
+// skipped on Windows.
+func checkFilePerms(path string, otherOwnerOK bool) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	for i, p := range []string{path, filepath.Dir(path)} {
+		info, err := os.Stat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		sticky := i == 1 && info.Mode()&os.ModeSticky != 0
+		if info.Mode().Perm()&0o022 != 0 && !sticky {
+			return &InsecureConfigError{
+				Path:    path,
+				Problem: fmt.Sprintf("%s is writable by group or others (mode %04o)", p, info.Mode().Perm()),
+				Fix:     "chmod go-w " + shellQuote(p),
+			}
+		}
+
+		uid, ok := fileOwner(info)
+		if ok && !otherOwnerOK && uid != 0 && uid != os.Geteuid() {
+			return &InsecureConfigError{
+				Path:    path,
+				Problem: fmt.Sprintf("%s is owned by another user (uid %d)", p, uid),
+				Fix:     fmt.Sprintf("sudo chown %d %s", os.Geteuid(), shellQuote(p)),
+			}
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
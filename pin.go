@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ErrFileChanged is returned when the file at a path is no longer the file
+// that was checked, e.g. because it was replaced while a dialog was open.
+var ErrFileChanged = errors.New("file changed since it was checked")
+
+// pinnedFile is an open handle on the file a request is about. Content checks
+// read from the handle, and verify makes sure the path still refers to the
+// same file (device and inode) right before it is handed to an opener.
+type pinnedFile struct {
+	file *os.File
+	info os.FileInfo
+}
+
+// errNotPinnable is returned for paths that are neither regular files nor
+// directories. Opening a FIFO blocks and opening a device can have side
+// effects, so they are never opened at all.
+var errNotPinnable = errors.New("not a regular file or directory")
+
+// pinFile opens path, following symlinks, and records its identity. The
+// open doesn't block, in case the path is swapped for a FIFO after the
+// first check.
+func pinFile(path string) (*pinnedFile, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if !pinnable(info) {
+		return nil, fmt.Errorf("%s: %w", path, errNotPinnable)
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !pinnable(info) {
+		err = fmt.Errorf("%s: %w", path, errNotPinnable)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &pinnedFile{file: f, info: info}, nil
+}
+
+func pinnable(info os.FileInfo) bool {
+	return info.Mode().IsRegular() || info.IsDir()
+}
+
+// verify checks that path still refers to the pinned file.
+func (p *pinnedFile) verify(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrFileChanged, path, err)
+	}
+	if !os.SameFile(p.info, info) {
+		return fmt.Errorf("%w: %s", ErrFileChanged, path)
+	}
+	return nil
+}
+
+func (p *pinnedFile) Close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,9 @@
+//go:build darwin
+
+package main
+
+// fdPath is not available on macOS: /dev/fd paths only work in the process
+// that has the descriptor open.
+func (p *pinnedFile) fdPath() string {
+	return ""
+}
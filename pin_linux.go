@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// fdPath returns a path that other processes of the user can open to get
+// the pinned file itself, whatever the original path now points to.
+func (p *pinnedFile) fdPath() string {
+	path := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), p.file.Fd())
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPinFileSpecial(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "report.pdf")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := pinFile(fifo)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errNotPinnable) {
+			t.Errorf("pinFile(fifo) = %v, want errNotPinnable", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pinFile blocked on a FIFO")
+	}
+
+	if _, err := pinFile("/dev/null"); !errors.Is(err, errNotPinnable) {
+		t.Errorf("pinFile(/dev/null) = %v, want errNotPinnable", err)
+	}
+
+	// The policy still decides, and rules looking at the content don't
+	// open it either.
+	rule, err := ParseRule(`block if mime == "application/pdf"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Rules: []Rule{rule}}
+	if v := cfg.CheckSecurity(fifo); v.Action != ActionAsk {
+		t.Errorf("CheckSecurity(fifo) = %v %q, want ask", v.Action, v.Rule)
+	}
+}
+
+func TestCheckPinnedOrigin(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(path, "user.xdg.origin.url", []byte("https://evil.example.net/document.pdf"), 0); err != nil {
+		t.Skipf("user xattrs not supported: %v", err)
+	}
+	pin, err := pinFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Close()
+
+	// Swapped for a file without the attribute after pinning, the path
+	// doesn't lose the origin of what gets opened.
+	clean := filepath.Join(dir, "clean.pdf")
+	if err := os.WriteFile(clean, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(clean, path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Allowed: []string{"*.pdf"}}
+	if v := cfg.checkPinned(path, pin); v.Action != ActionAsk || v.Origin == nil {
+		t.Errorf("checkPinned = %v %q origin %v, want ask with the pinned file's origin", v.Action, v.Rule, v.Origin)
+	}
+	if p := newFileFacts(path, nil, pin).platform(); p.fstype == "" {
+		t.Error("no filesystem type for the pinned file")
+	}
+}
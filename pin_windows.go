@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// fdPath is not available on Windows, which has no paths for open handles.
+func (p *pinnedFile) fdPath() string {
+	return ""
+}
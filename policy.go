@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TrustedPolicyKeys is a comma-separated list of base64 Ed25519 public keys
+// allowed to sign policy bundles, set at build time:
+// -ldflags "-X main.TrustedPolicyKeys=..."
+var TrustedPolicyKeys = ""
+
+// SystemConfig is the machine-wide config. It lives outside the user's
+// reach, so it is where managed machines point at their policy bundle.
+type SystemConfig struct {
+	// TrustedKeys are base64 Ed25519 public keys, in addition to the ones
+	// built into the binary.
+	TrustedKeys []string `yaml:"trusted_keys"`
+	// Policy is the path to a signed policy bundle: an ope.yml with a
+	// detached signature in Policy + ".sig".
+	Policy string `yaml:"policy"`
+	// AsRoot is what to do when ope runs as root: "refuse" (the default) or
+	// "drop-sudo"; see checkRoot.
+	AsRoot string `yaml:"as_root,omitempty"`
+}
+
+// systemConfigFile is the path of the machine-wide config.
+var systemConfigFile = defaultSystemConfigFile()
+
+func defaultSystemConfigFile() string {
+	switch runtime.GOOS {
+	case "windows":
+		dir := os.Getenv("ProgramData")
+		if dir == "" {
+			dir = `C:\ProgramData`
+		}
+		return filepath.Join(dir, "ope", "ope.yml")
+	case "darwin":
+		return "/Library/Application Support/ope/ope.yml"
+	default:
+		return "/etc/ope/ope.yml"
+	}
+}
+
+// LoadSystemConfig reads the machine-wide config. A missing file yields an
+// empty config.
+func LoadSystemConfig() (*SystemConfig, error) {
+	sys := &SystemConfig{}
+	if err := checkFilePerms(systemConfigFile, false); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(systemConfigFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sys, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, sys); err != nil {
+		return nil, fmt.Errorf("%s: %w", systemConfigFile, err)
+	}
+	return sys, nil
+}
+
+// trustedKeys returns the built-in keys plus the ones in the system config.
+func (s *SystemConfig) trustedKeys() ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	encoded := append(strings.Split(TrustedPolicyKeys, ","), s.TrustedKeys...)
+	for _, enc := range encoded {
+		enc = strings.TrimSpace(enc)
+		if enc == "" {
+			continue
+		}
+		key, err := decodeKey(enc, ed25519.PublicKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("trusted key %q: %w", enc, err)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+func decodeKey(enc string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("want %d bytes, got %d", size, len(key))
+	}
+	return key, nil
+}
+
+// errBadSignature is returned when no trusted key verifies a bundle.
+var errBadSignature = errors.New("signature does not match any trusted key")
+
+// verifyBundle checks the base64 signature sig of data against keys and
+// returns the index of the key that signed it.
+func verifyBundle(data, sig []byte, keys []ed25519.PublicKey) (int, error) {
+	if len(keys) == 0 {
+		return -1, errors.New("no trusted keys configured")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return -1, errors.New("malformed signature")
+	}
+	for i, key := range keys {
+		if ed25519.Verify(key, data, raw) {
+			return i, nil
+		}
+	}
+	return -1, errBadSignature
+}
+
+// openBundle reads a bundle and its signature, verifies it and checks that
+// it is a valid config. It returns the config's YAML node along with the
+// verified bytes.
+func openBundle(path string, keys []ed25519.PublicKey) (node *yaml.Node, data, sig []byte, err error) {
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, nil, nil, err
+	}
+	if sig, err = os.ReadFile(path + ".sig"); err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := verifyBundle(data, sig, keys); err != nil {
+		return nil, nil, nil, err
+	}
+	if node, err = parseBundleData(data); err != nil {
+		return nil, nil, nil, err
+	}
+	return node, data, sig, nil
+}
+
+// parseBundleData parses a bundle and checks that it is a valid config.
+func parseBundleData(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{}, nil
+	}
+	if err := doc.Content[0].Decode(&Config{}); err != nil {
+		return nil, err
+	}
+	return doc.Content[0], nil
+}
+
+// lastGoodPolicyPath returns where the last successfully verified bundle is
+// kept.
+func lastGoodPolicyPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "policy.last-good.yml"), nil
+}
+
+// loadPolicyBundle verifies the configured bundle and remembers it as the
+// last known good copy. If the bundle is missing, tampered with or invalid,
+// the last known good copy is used instead, after verifying it again. With
+// neither available the error is returned and the caller must fail closed.
+func loadPolicyBundle(sys *SystemConfig) (*yaml.Node, error) {
+	keys, err := sys.trustedKeys()
+	if err != nil {
+		return nil, err
+	}
+	goodPath, goodErr := lastGoodPolicyPath()
+
+	node, data, sig, bundleErr := openBundle(sys.Policy, keys)
+	if bundleErr == nil {
+		if goodErr == nil && !readOnly && os.MkdirAll(filepath.Dir(goodPath), 0o700) == nil {
+			_ = os.WriteFile(goodPath, data, 0o600)
+			_ = os.WriteFile(goodPath+".sig", sig, 0o600)
+		}
+		return node, nil
+	}
+
+	if goodErr == nil {
+		if node, _, _, err := openBundle(goodPath, keys); err == nil {
+			fmt.Fprintf(os.Stderr, "Warning: policy %s: %v; using last known good copy\n", sys.Policy, bundleErr)
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("policy %s: %w (no valid last known good copy)", sys.Policy, bundleErr)
+}
+
+// applyPolicy applies a verified policy bundle on top of the user's config,
+// so that the user can't weaken it: its blocked entries go to policyBlocked,
+// its rules (including those of matching when blocks) are evaluated before
+// the user's, and its settings win. Includes in a bundle are ignored.
+func (c *Config) applyPolicy(node *yaml.Node, m machine) error {
+	userBlocked, userRules, userWhen := c.Blocked, c.Rules, c.When
+	c.Blocked, c.Rules, c.When = nil, nil, nil
+	if err := c.overlay(node); err != nil {
+		return err
+	}
+	if err := c.applyWhen(m); err != nil {
+		return err
+	}
+	c.policyBlocked = appendNew(c.policyBlocked, c.Blocked...)
+	c.Blocked = userBlocked
+	c.Rules = append(c.Rules, userRules...)
+	c.When = userWhen
+	return nil
+}
+
+// applySystemPolicy loads and applies the policy bundle named in the system
+// config, if any.
+func (c *Config) applySystemPolicy() error {
+	sys, err := LoadSystemConfig()
+	if err != nil {
+		return err
+	}
+	if sys.Policy == "" {
+		return nil
+	}
+	node, err := loadPolicyBundle(sys)
+	if err != nil {
+		return err
+	}
+	return c.applyPolicy(node, currentMachine())
+}
+
+// runPolicy implements `ope policy keygen|sign|verify|simulate`.
+func runPolicy(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ope policy keygen|sign|verify|simulate ...")
+	}
+
+	switch args[0] {
+	case "keygen":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: ope policy keygen <name>")
+		}
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1]+".key", []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0o600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1]+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Private key: %s.key\n", args[1])
+		fmt.Printf("Public key:  %s.pub\n", args[1])
+		fmt.Printf("Add to trusted_keys: %s\n", base64.StdEncoding.EncodeToString(pub))
+		return nil
+
+	case "sign":
+		if len(args) != 4 || args[1] != "--key" {
+			return fmt.Errorf("usage: ope policy sign --key <private key file> <bundle>")
+		}
+		keyData, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		priv, err := decodeKey(string(keyData), ed25519.PrivateKeySize)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[2], err)
+		}
+		data, err := os.ReadFile(args[3])
+		if err != nil {
+			return err
+		}
+		if _, err := parseBundleData(data); err != nil {
+			return fmt.Errorf("%s: %w", args[3], err)
+		}
+		sig := ed25519.Sign(ed25519.PrivateKey(priv), data)
+		if err := os.WriteFile(args[3]+".sig", []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Signed: %s.sig\n", args[3])
+		return nil
+
+	case "verify":
+		var keys []ed25519.PublicKey
+		rest := args[1:]
+		if len(rest) == 3 && rest[0] == "--key" {
+			keyData, err := os.ReadFile(rest[1])
+			if err != nil {
+				return err
+			}
+			key, err := decodeKey(string(keyData), ed25519.PublicKeySize)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rest[1], err)
+			}
+			keys = []ed25519.PublicKey{key}
+			rest = rest[2:]
+		} else {
+			sys, err := LoadSystemConfig()
+			if err != nil {
+				return err
+			}
+			if keys, err = sys.trustedKeys(); err != nil {
+				return err
+			}
+		}
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: ope policy verify [--key <public key file>] <bundle>")
+		}
+		data, err := os.ReadFile(rest[0])
+		if err != nil {
+			return err
+		}
+		sig, err := os.ReadFile(rest[0] + ".sig")
+		if err != nil {
+			return err
+		}
+		i, err := verifyBundle(data, sig, keys)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rest[0], err)
+		}
+		if _, err := parseBundleData(data); err != nil {
+			return fmt.Errorf("%s: %w", rest[0], err)
+		}
+		fmt.Printf("OK: %s signed by %s\n", rest[0], base64.StdEncoding.EncodeToString(keys[i]))
+		return nil
+
+	case "simulate":
+		return runSimulate(args[1:])
+
+	default:
+		return fmt.Errorf("unknown policy command: %s", args[0])
+	}
+}
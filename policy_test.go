@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignedPolicyBundle(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+allowed: ["*.sh"]
+rules:
+  - allow if true
+`,
+	})
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+
+	bundle := writePolicyBundle(t, dir, `
+blocked: ["*.sh"]
+rules:
+  - ask if ext == ".txt"
+`)
+
+	check := func(wantSh, wantTxt SecurityAction) {
+		t.Helper()
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if got := cfg.CheckSecurity("/tmp/run.sh").Action; got != wantSh {
+			t.Errorf("run.sh: got %v, want %v", got, wantSh)
+		}
+		if got := cfg.CheckSecurity("/tmp/notes.txt").Action; got != wantTxt {
+			t.Errorf("notes.txt: got %v, want %v", got, wantTxt)
+		}
+	}
+
+	// The policy wins over the user's allow entries and rules.
+	check(ActionBlock, ActionAsk)
+
+	// A tampered bundle falls back to the last known good copy.
+	if err := os.WriteFile(bundle, []byte("blocked: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check(ActionBlock, ActionAsk)
+
+	// Without a good copy, loading fails closed.
+	good, _ := lastGoodPolicyPath()
+	if err := os.Remove(good); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig with tampered bundle and no good copy succeeded")
+	}
+}
+
+// writePolicyBundle signs policy with a new key, writes it to dir and makes
+// the system config name it as the policy bundle.
+func writePolicyBundle(t *testing.T, dir, policy string) string {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := filepath.Join(dir, "policy.yml")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(policy)))
+	if err := os.WriteFile(bundle, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bundle+".sig", []byte(sig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSystem := systemConfigFile
+	systemConfigFile = filepath.Join(dir, "system.yml")
+	t.Cleanup(func() { systemConfigFile = oldSystem })
+	system := "policy: " + bundle + "\ntrusted_keys: [" + base64.StdEncoding.EncodeToString(pub) + "]\n"
+	if err := os.WriteFile(systemConfigFile, []byte(system), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestSignedPolicyNegation(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+blocked: ["!*.sh"]
+allowed: ["*.sh"]
+`,
+	})
+	state := filepath.Join(dir, "state")
+	t.Setenv("XDG_STATE_HOME", state)
+	writePolicyBundle(t, dir, `blocked: ["*.sh"]`+"\n")
+
+	// A negation in the user's config doesn't take back the policy's entry.
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if v := cfg.CheckSecurity("/tmp/run.sh"); v.Action != ActionBlock || v.Rule != "blocked: *.sh (from policy)" {
+		t.Errorf("run.sh: got %v %q, want block by the policy", v.Action, v.Rule)
+	}
+
+	// Nor does one in the learned decisions, which are refused outright.
+	if err := os.MkdirAll(filepath.Join(state, "ope"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	decisions := "blocked: [\"!*.sh\"]\nallowed: [\"*.sh\"]\n"
+	if err := os.WriteFile(filepath.Join(state, "ope", "decisions.yml"), []byte(decisions), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig with a negated decision succeeded")
+	}
+}
+
+func TestSignedPolicyScanner(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"ope.yml": `
+scanner:
+  command: [true]
+  timeout: 1ns
+  on_error: open
+  on_timeout: open
+env:
+  mode: inherit
+  keep: [LD_PRELOAD]
+`,
+	})
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	writePolicyBundle(t, dir, `
+scanner:
+  command: [clamdscan, --fdpass]
+env:
+  mode: clean
+`)
+
+	// The policy's blocks replace the user's instead of being merged into
+	// them, so the user can't make its scanner fail open.
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if s := cfg.Scanner; s == nil || len(s.Command) != 2 || s.Timeout != 0 || s.OnError != "" || s.OnTimeout != "" {
+		t.Errorf("Scanner = %+v, want the policy's alone", s)
+	}
+	if e := cfg.Env; e == nil || e.Mode != envClean || len(e.Keep) != 0 {
+		t.Errorf("Env = %+v, want the policy's alone", e)
+	}
+}
+
+func TestRecordDecisionEscapesNegation(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if err := RecordDecision(false, "!notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDecisions()
+	if err != nil {
+		t.Fatalf("LoadDecisions: %v", err)
+	}
+	if len(d.Blocked) != 1 || d.Blocked[0] != `\!notes.txt` {
+		t.Errorf("Blocked = %q, want [\\!notes.txt]", d.Blocked)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is not implemented here; snapshots are plain copies.
+func reflink(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Settings for as_root in the system config.
+const (
+	asRootRefuse   = "refuse"
+	asRootDropSudo = "drop-sudo"
+)
+
+// errRunningAsRoot is returned when ope refuses to run as root.
+var errRunningAsRoot = errors.New("ope is running as root")
+
+// checkRoot refuses to go on as root, the default, or with as_root:
+// drop-sudo in the system config, switches to the user who ran sudo. The
+// setting is read from the system config only, because root's and the
+// sudo user's config could both be the one found.
+func checkRoot() error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	sys, err := LoadSystemConfig()
+	if err != nil {
+		return err
+	}
+	switch sys.AsRoot {
+	case "", asRootRefuse:
+		return fmt.Errorf("%w: it would open files with root's rights and leave root-owned files "+
+			"in your config directory. Run it as your own user, or set as_root: %s in %s "+
+			"to switch back to the user who ran sudo", errRunningAsRoot, asRootDropSudo, systemConfigFile)
+	case asRootDropSudo:
+		return dropSudo(os.Getenv)
+	default:
+		return fmt.Errorf("%s: as_root: %q is not %q or %q", systemConfigFile, sys.AsRoot, asRootRefuse, asRootDropSudo)
+	}
+}
+
+// sudoUser is the user sudo was run by, from SUDO_UID and SUDO_GID.
+type sudoUser struct {
+	uid, gid int
+	groups   []int
+	name     string
+	home     string
+}
+
+// lookupSudoUser returns the user that ran sudo, or an error if ope
+// wasn't started through sudo by someone other than root.
+func lookupSudoUser(getenv func(string) string) (*sudoUser, error) {
+	uid, err := strconv.Atoi(getenv("SUDO_UID"))
+	if err != nil || uid == 0 {
+		return nil, fmt.Errorf("%w, not through sudo by another user (SUDO_UID is %q)", errRunningAsRoot, getenv("SUDO_UID"))
+	}
+	gid, err := strconv.Atoi(getenv("SUDO_GID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SUDO_GID %q", getenv("SUDO_GID"))
+	}
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return nil, err
+	}
+	su := &sudoUser{uid: uid, gid: gid, name: u.Username, home: u.HomeDir}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("groups of %s: %w", u.Username, err)
+	}
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil {
+			su.groups = append(su.groups, n)
+		}
+	}
+	return su, nil
+}
+
+// dropSudo switches the whole process to the user that ran sudo, for good,
+// and points HOME, USER, LOGNAME and XDG_RUNTIME_DIR at that user's, so
+// that their config is the one used.
+func dropSudo(getenv func(string) string) error {
+	su, err := lookupSudoUser(getenv)
+	if err != nil {
+		return err
+	}
+	if err := dropPrivileges(su.uid, su.gid, su.groups); err != nil {
+		return fmt.Errorf("switching to %s: %w", su.name, err)
+	}
+	if os.Geteuid() != su.uid || os.Getuid() != su.uid {
+		return fmt.Errorf("switching to %s: still running as user %d", su.name, os.Geteuid())
+	}
+
+	os.Setenv("HOME", su.home)
+	os.Setenv("USER", su.name)
+	os.Setenv("LOGNAME", su.name)
+	os.Unsetenv("XDG_RUNTIME_DIR")
+	dir := filepath.Join("/run/user", strconv.Itoa(su.uid))
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		os.Setenv("XDG_RUNTIME_DIR", dir)
+	}
+	return nil
+}
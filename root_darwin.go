@@ -0,0 +1,17 @@
+//go:build darwin
+
+package main
+
+import "syscall"
+
+// dropPrivileges sets the groups, group ID and user ID of the process; see
+// the Linux version.
+func dropPrivileges(uid, gid int, groups []int) error {
+	if err := syscall.Setgroups(groups); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	return syscall.Setuid(uid)
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// dropPrivileges sets the groups, group ID and user ID, in that order,
+// since changing the user ID first would lose the right to change the
+// others. Go applies them to every thread of the process.
+func dropPrivileges(uid, gid int, groups []int) error {
+	if err := syscall.Setgroups(groups); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	return syscall.Setuid(uid)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestCheckRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		if err := checkRoot(); err != nil {
+			t.Errorf("checkRoot as user %d: %v", os.Geteuid(), err)
+		}
+		t.Skip("the rest needs root")
+	}
+
+	dir := t.TempDir()
+	oldSystem := systemConfigFile
+	systemConfigFile = filepath.Join(dir, "system.yml")
+	t.Cleanup(func() { systemConfigFile = oldSystem })
+
+	if err := checkRoot(); !errors.Is(err, errRunningAsRoot) {
+		t.Errorf("checkRoot without a system config = %v, want refusal", err)
+	}
+	if err := os.WriteFile(systemConfigFile, []byte("as_root: sudo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoot(); err == nil || errors.Is(err, errRunningAsRoot) {
+		t.Errorf("checkRoot with an invalid as_root = %v, want a config error", err)
+	}
+}
+
+func TestLookupSudoUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sudo on Windows")
+	}
+	env := func(uid, gid string) func(string) string {
+		return func(key string) string {
+			return map[string]string{"SUDO_UID": uid, "SUDO_GID": gid}[key]
+		}
+	}
+	for _, uid := range []string{"", "0", "me"} {
+		if _, err := lookupSudoUser(env(uid, "0")); !errors.Is(err, errRunningAsRoot) {
+			t.Errorf("SUDO_UID=%q: got %v, want refusal", uid, err)
+		}
+	}
+
+	u, err := user.Current()
+	if err != nil || u.Uid == "0" {
+		if u, err = user.Lookup("nobody"); err != nil {
+			t.Skip("no non-root user to look up")
+		}
+	}
+	if _, err := lookupSudoUser(env(u.Uid, "x")); err == nil {
+		t.Error("invalid SUDO_GID accepted")
+	}
+	su, err := lookupSudoUser(env(u.Uid, u.Gid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strconv.Itoa(su.uid) != u.Uid || strconv.Itoa(su.gid) != u.Gid || su.name != u.Username || su.home != u.HomeDir {
+		t.Errorf("lookupSudoUser = %+v, want %s", su, u.Username)
+	}
+}
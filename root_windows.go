@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "errors"
+
+// dropPrivileges is never called on Windows, where os.Geteuid returns -1.
+func dropPrivileges(uid, gid int, groups []int) error {
+	return errors.ErrUnsupported
+}
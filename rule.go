@@ -0,0 +1,494 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is a policy rule with a condition over file attributes, written as
+// "<action> if <condition>", for example:
+//
+//	ask if size > 500MB
+//	block if fstype == "nfs" and ext == ".sh"
+//	allow if path under "~/Projects" and not hidden
+//	open-with "libreoffice --view" if ext == ".docx"
+//
+// open-with takes the application as a string before "if"; see
+// openWithCommand for what it may be on each platform.
+//
+// Conditions combine comparisons (==, !=, <, <=, >, >=), glob matching
+// (matches), directory containment (under) and bit tests (mode & 0o002 != 0)
+// with and, or, not and parentheses. See attributes for the available names.
+type Rule struct {
+	Source string
+	Action SecurityAction
+	// App is the application of an open-with rule.
+	App  string
+	cond expr
+}
+
+// ParseRule compiles a rule from its textual form.
+func ParseRule(src string) (Rule, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", src, err)
+	}
+	rule, err := p.parseRule()
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", src, err)
+	}
+	rule.Source = src
+	return rule, nil
+}
+
+// Matches reports whether the rule's condition holds for the file.
+func (r Rule) Matches(f *fileFacts) bool {
+	if r.cond == nil {
+		return false
+	}
+	b, _ := r.cond.eval(f).(bool)
+	return b
+}
+
+func (r *Rule) UnmarshalYAML(node *yaml.Node) error {
+	var src string
+	if err := node.Decode(&src); err != nil {
+		return err
+	}
+	parsed, err := ParseRule(src)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rule) MarshalYAML() (interface{}, error) {
+	return r.Source, nil
+}
+
+// parseAction looks up an action by the name it has in rules.
+func parseAction(name string) (SecurityAction, bool) {
+	for action, s := range actionStrings {
+		if s == name {
+			return action, true
+		}
+	}
+	return 0, false
+}
+
+// Attributes returns the names of the file attributes the condition uses,
+// in order of first use.
+func (r Rule) Attributes() []string {
+	var names []string
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case attrRef:
+			if !slices.Contains(names, e.name) {
+				names = append(names, e.name)
+			}
+		case notExpr:
+			walk(e.x)
+		case binaryExpr:
+			walk(e.l)
+			walk(e.r)
+		}
+	}
+	if r.cond != nil {
+		walk(r.cond)
+	}
+	return names
+}
+
+// valueKind is the static type of an expression.
+type valueKind int
+
+const (
+	kindInt valueKind = iota
+	kindString
+	kindBool
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindInt:
+		return "number"
+	case kindString:
+		return "string"
+	default:
+		return "bool"
+	}
+}
+
+// expr is a type-checked condition node. eval returns int64, string or bool
+// according to kind.
+type expr interface {
+	kind() valueKind
+	eval(f *fileFacts) any
+}
+
+type literal struct{ v any }
+
+func (l literal) kind() valueKind {
+	switch l.v.(type) {
+	case int64:
+		return kindInt
+	case string:
+		return kindString
+	default:
+		return kindBool
+	}
+}
+
+func (l literal) eval(*fileFacts) any { return l.v }
+
+type attrRef struct {
+	name string
+	attr attribute
+}
+
+func (a attrRef) kind() valueKind       { return a.attr.kind }
+func (a attrRef) eval(f *fileFacts) any { return f.get(a.name) }
+
+type notExpr struct{ x expr }
+
+func (n notExpr) kind() valueKind       { return kindBool }
+func (n notExpr) eval(f *fileFacts) any { return !n.x.eval(f).(bool) }
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (b binaryExpr) kind() valueKind {
+	if b.op == "&" {
+		return kindInt
+	}
+	return kindBool
+}
+
+func (b binaryExpr) eval(f *fileFacts) any {
+	switch b.op {
+	case "and":
+		return b.l.eval(f).(bool) && b.r.eval(f).(bool)
+	case "or":
+		return b.l.eval(f).(bool) || b.r.eval(f).(bool)
+	case "&":
+		return b.l.eval(f).(int64) & b.r.eval(f).(int64)
+	case "matches":
+		pattern := strings.ToLower(b.r.eval(f).(string))
+		matched, _ := filepath.Match(pattern, strings.ToLower(b.l.eval(f).(string)))
+		return matched
+	case "under":
+		return isUnder(b.l.eval(f).(string), expandHome(b.r.eval(f).(string)))
+	}
+
+	l, r := b.l.eval(f), b.r.eval(f)
+	switch b.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	li, ri := l.(int64), r.(int64)
+	switch b.op {
+	case "<":
+		return li < ri
+	case "<=":
+		return li <= ri
+	case ">":
+		return li > ri
+	default:
+		return li >= ri
+	}
+}
+
+// isUnder reports whether path is dir or lies inside it.
+func isUnder(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// units maps number suffixes to multipliers. Sizes use decimal (KB) and
+// binary (KiB) prefixes, durations are in seconds.
+var units = map[string]int64{
+	"b": 1, "kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40,
+	"s": 1, "m": 60, "h": 3600, "d": 86400, "w": 7 * 86400,
+}
+
+type token struct {
+	text string
+	str  bool // quoted string literal
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", src[i:j+1])
+			}
+			toks = append(toks, token{text: s, str: true})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			if i+1 < len(src) && src[i+1] == '=' {
+				toks = append(toks, token{text: src[i : i+2]})
+				i += 2
+			} else if c == '<' || c == '>' {
+				toks = append(toks, token{text: src[i : i+1]})
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+		case c == '(' || c == ')' || c == '&':
+			toks = append(toks, token{text: src[i : i+1]})
+			i++
+		case c == '_' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '-' || src[j] == '.' ||
+				unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{text: src[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func newParser(src string) (*parser, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{toks: toks}, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.toks) || p.toks[p.pos].str {
+		return ""
+	}
+	return p.toks[p.pos].text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek() == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseRule() (Rule, error) {
+	if p.pos >= len(p.toks) {
+		return Rule{}, fmt.Errorf("empty rule")
+	}
+	name := p.peek()
+	action, ok := parseAction(name)
+	if !ok {
+		return Rule{}, fmt.Errorf("unknown action %q", name)
+	}
+	p.pos++
+	rule := Rule{Action: action}
+	if action == ActionOpenWith {
+		if p.pos >= len(p.toks) || !p.toks[p.pos].str || p.toks[p.pos].text == "" {
+			return Rule{}, fmt.Errorf("expected an application in quotes after %q", name)
+		}
+		rule.App = p.toks[p.pos].text
+		p.pos++
+	}
+	if !p.accept("if") {
+		return Rule{}, fmt.Errorf("expected \"if\" after %q", name)
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return Rule{}, err
+	}
+	if p.pos < len(p.toks) {
+		return Rule{}, fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if cond.kind() != kindBool {
+		return Rule{}, fmt.Errorf("condition is a %s, not a bool", cond.kind())
+	}
+	rule.cond = cond
+	return rule, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	return p.parseLogical("and", p.parseNot)
+}
+
+func (p *parser) parseLogical(op string, next func() (expr, error)) (expr, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(op) {
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != kindBool || r.kind() != kindBool {
+			return nil, fmt.Errorf("%q needs bool operands", op)
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("not") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != kindBool {
+			return nil, fmt.Errorf("\"not\" needs a bool operand")
+		}
+		return notExpr{x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (expr, error) {
+	l, err := p.parseBitAnd()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "matches", "under":
+		p.pos++
+	default:
+		return l, nil
+	}
+	r, err := p.parseBitAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "==", "!=":
+		if l.kind() != r.kind() {
+			return nil, fmt.Errorf("cannot compare %s with %s", l.kind(), r.kind())
+		}
+	case "matches", "under":
+		if l.kind() != kindString || r.kind() != kindString {
+			return nil, fmt.Errorf("%q needs string operands", op)
+		}
+	default:
+		if l.kind() != kindInt || r.kind() != kindInt {
+			return nil, fmt.Errorf("%q needs number operands", op)
+		}
+	}
+	return binaryExpr{op: op, l: l, r: r}, nil
+}
+
+func (p *parser) parseBitAnd() (expr, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&") {
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != kindInt || r.kind() != kindInt {
+			return nil, fmt.Errorf("\"&\" needs number operands")
+		}
+		l = binaryExpr{op: "&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of rule")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+
+	if tok.str {
+		return literal{tok.text}, nil
+	}
+	switch tok.text {
+	case "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing \")\"")
+		}
+		return x, nil
+	case "true":
+		return literal{true}, nil
+	case "false":
+		return literal{false}, nil
+	}
+	if unicode.IsDigit(rune(tok.text[0])) {
+		return parseNumber(tok.text)
+	}
+	if attr, ok := attributes[tok.text]; ok {
+		return attrRef{name: tok.text, attr: attr}, nil
+	}
+	return nil, fmt.Errorf("unknown attribute %q", tok.text)
+}
+
+// parseNumber parses integers in any Go base (0o755, 0x1f) and decimal
+// numbers with a size or duration suffix (500MB, 1.5GiB, 30d).
+func parseNumber(text string) (expr, error) {
+	if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return literal{n}, nil
+	}
+	split := strings.IndexFunc(text, unicode.IsLetter)
+	if split > 0 {
+		mult, ok := units[strings.ToLower(text[split:])]
+		n, err := strconv.ParseFloat(text[:split], 64)
+		if ok && err == nil {
+			return literal{int64(n * float64(mult))}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid number %q", text)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseRule(t *testing.T) {
+	valid := []string{
+		"ask if size > 500MB",
+		`block if fstype == "nfs" and ext == ".sh"`,
+		`allow if path under "~/Projects" and not hidden`,
+		"block if mode & 0o002 != 0",
+		`ask if (age < 1d or origin != "") and name matches "*.pdf"`,
+		`reveal if ext == ".sh"`,
+		`copy-path if size > 1GB`,
+		`open-with "libreoffice --view" if ext == ".docx"`,
+		`ask-always if path under "~/Secrets"`,
+	}
+	for _, src := range valid {
+		if _, err := ParseRule(src); err != nil {
+			t.Errorf("ParseRule(%q): %v", src, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"open if size > 1",
+		"ask size > 1",
+		"ask if size",
+		`ask if size > "big"`,
+		"ask if colour == 1",
+		`ask if ext == ".sh`,
+		"ask if (size > 1",
+		"ask if hidden and size",
+		`open-with if ext == ".docx"`,
+		`open-with "" if ext == ".docx"`,
+		`open-with libreoffice if ext == ".docx"`,
+	}
+	for _, src := range invalid {
+		if _, err := ParseRule(src); err == nil {
+			t.Errorf("ParseRule(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "build.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho hi\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{`ask if ext == ".sh"`, true},
+		{"ask if size > 1KB", false},
+		{"ask if size >= 18", true},
+		{"ask if mode & 0o111 != 0", true},
+		{"ask if age < 1h", true},
+		{`ask if type == "file" and not hidden`, true},
+		{`ask if name matches "*.SH"`, true},
+		{`ask if path under "` + dir + `"`, true},
+		{`ask if path under "` + dir + `x"`, false},
+		{`ask if origin == ""`, true},
+	}
+
+	facts := newFileFacts(script, nil, nil)
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", tt.rule, err)
+		}
+		if got := rule.Matches(facts); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSecurityRules(t *testing.T) {
+	var cfg Config
+	data := `
+blocked: ["*.exe"]
+allowed: ["*.txt"]
+rules:
+  - ask if size > 10B
+  - allow if ext == ".log"
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(big, []byte("more than ten bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		want     SecurityAction
+		wantRule string
+	}{
+		{big, ActionAsk, "rule: ask if size > 10B"},
+		{filepath.Join(dir, "small.txt"), ActionAllow, "allowed: *.txt"},
+		{filepath.Join(dir, "app.log"), ActionAllow, "rule: allow if ext == \".log\""},
+		{filepath.Join(dir, "app.exe"), ActionBlock, "blocked: *.exe"},
+	}
+	for _, tt := range tests {
+		v := cfg.CheckSecurity(tt.path)
+		if v.Action != tt.want || v.Rule != tt.wantRule {
+			t.Errorf("CheckSecurity(%q) = %v %q, want %v %q", tt.path, v.Action, v.Rule, tt.want, tt.wantRule)
+		}
+	}
+
+	if _, err := yaml.Marshal(&cfg); err != nil {
+		t.Errorf("marshal config with rules: %v", err)
+	}
+}
+
+func TestCheckSecurityRuleActions(t *testing.T) {
+	var cfg Config
+	data := `
+blocked: ["*.sh", "*.exe"]
+allowed: ["*.pdf", "*.txt"]
+rules:
+  - reveal if ext == ".sh"
+  - copy-path if name == "id_rsa"
+  - open-with "evince" if ext == ".pdf"
+  - ask-always if name matches "secret*"
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		want     SecurityAction
+		wantRule string
+		wantApp  string
+	}{
+		{"deploy.sh", ActionReveal, `rule: reveal if ext == ".sh" (blocked: *.sh)`, ""},
+		{"setup.exe", ActionBlock, "blocked: *.exe", ""},
+		{"id_rsa", ActionCopyPath, `rule: copy-path if name == "id_rsa"`, ""},
+		{"report.pdf", ActionOpenWith, `rule: open-with "evince" if ext == ".pdf"`, "evince"},
+		{"pаypal.pdf", ActionAsk, `rule: open-with "evince" if ext == ".pdf" (asking: deceptive name)`, "evince"},
+		{"secrets.txt", ActionAskAlways, `rule: ask-always if name matches "secret*"`, ""},
+	}
+	for _, tt := range tests {
+		v := cfg.CheckSecurity(filepath.Join(dir, tt.name))
+		if v.Action != tt.want || v.Rule != tt.wantRule || v.App != tt.wantApp {
+			t.Errorf("CheckSecurity(%q) = %v %q app %q, want %v %q app %q",
+				tt.name, v.Action, v.Rule, v.App, tt.want, tt.wantRule, tt.wantApp)
+		}
+	}
+
+	// A reveal rule in a .ope.yml doesn't soften a block.
+	local := `rules: ['reveal if ext == ".exe"']`
+	if err := os.WriteFile(filepath.Join(dir, localPolicyName), []byte(local), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v := cfg.CheckSecurity(filepath.Join(dir, "setup.exe")); v.Action != ActionBlock {
+		t.Errorf("local reveal rule: got %v %q, want block", v.Action, v.Rule)
+	}
+
+	cfg.Mode = modeKiosk
+	cfg.Roots = []string{dir}
+	if v := cfg.CheckSecurity(filepath.Join(dir, "secrets.txt")); v.Action != ActionBlock {
+		t.Errorf("ask-always in kiosk mode: got %v, want block", v.Action)
+	}
+}
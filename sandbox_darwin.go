@@ -0,0 +1,11 @@
+//go:build darwin
+
+package main
+
+import "errors"
+
+// sandboxCommand is only implemented on Linux, where bwrap and firejail
+// exist. Sandboxed files are never opened unsandboxed.
+func sandboxCommand(path string) ([]string, error) {
+	return nil, errors.New("the sandbox action is only supported on Linux")
+}
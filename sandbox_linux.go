@@ -0,0 +1,225 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sandboxCommand returns the command that opens path with its default
+// application inside bwrap, or firejail if bwrap isn't installed. The
+// sandbox has no network, a private /tmp and an empty home, and sees only
+// this one file, read-only.
+func sandboxCommand(path string) ([]string, error) {
+	app, err := defaultAppCommand(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("bwrap"); err == nil {
+		return bwrapArgs(path, app, os.Getenv), nil
+	}
+	if _, err := exec.LookPath("firejail"); err == nil {
+		return firejailArgs(path, app), nil
+	}
+	return nil, errors.New("no sandbox available: install bubblewrap (bwrap) or firejail")
+}
+
+// bwrapArgs wraps app in bwrap: system directories read-only, fresh /tmp,
+// /run and home, every namespace unshared (so no network), the display
+// sockets and the file bound read-only.
+func bwrapArgs(path string, app []string, getenv func(string) string) []string {
+	args := []string{"bwrap",
+		"--unshare-all", "--die-with-parent", "--new-session",
+		"--ro-bind", "/usr", "/usr",
+		"--ro-bind-try", "/etc", "/etc",
+	}
+	for _, dir := range []string{"/bin", "/sbin", "/lib", "/lib32", "/lib64"} {
+		args = append(args, "--ro-bind-try", dir, dir)
+	}
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp", "--tmpfs", "/run")
+	if home := getenv("HOME"); home != "" {
+		args = append(args, "--tmpfs", home)
+	}
+
+	args = append(args, "--ro-bind-try", "/tmp/.X11-unix", "/tmp/.X11-unix")
+	if auth := getenv("XAUTHORITY"); auth != "" {
+		args = append(args, "--ro-bind-try", auth, auth)
+	}
+	if runtime := getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		args = append(args, "--dir", runtime)
+		if wayland := getenv("WAYLAND_DISPLAY"); wayland != "" {
+			socket := wayland
+			if !filepath.IsAbs(socket) {
+				socket = filepath.Join(runtime, wayland)
+			}
+			args = append(args, "--ro-bind-try", socket, socket)
+		}
+	}
+
+	args = append(args, "--ro-bind", path, path, "--")
+	return append(args, app...)
+}
+
+// firejailArgs wraps app in firejail, which can't hide the filesystem as
+// thoroughly as bwrap: only the file is whitelisted, which hides the rest
+// of the home directory, /tmp is private and there is no network.
+func firejailArgs(path string, app []string) []string {
+	args := []string{"firejail", "--quiet", "--net=none", "--private-tmp", "--nosound",
+		"--whitelist=" + path, "--read-only=" + path, "--"}
+	return append(args, app...)
+}
+
+// defaultAppCommand returns the command line of the default application
+// for path, from the .desktop file xdg-mime names for its MIME type.
+func defaultAppCommand(path string) ([]string, error) {
+	out, err := exec.Command("xdg-mime", "query", "filetype", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("xdg-mime query filetype: %w", err)
+	}
+	mimeType := strings.TrimSpace(string(out))
+	out, err = exec.Command("xdg-mime", "query", "default", mimeType).Output()
+	if err != nil {
+		return nil, fmt.Errorf("xdg-mime query default %s: %w", mimeType, err)
+	}
+	id := strings.TrimSpace(string(out))
+	if id == "" {
+		return nil, fmt.Errorf("no default application for %s", mimeType)
+	}
+
+	desktop, err := findDesktopFile(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(desktop)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := desktopExec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", desktop, err)
+	}
+	return expandExec(line, path)
+}
+
+// findDesktopFile looks up a desktop file ID in the XDG data directories.
+// A "-" in the ID may stand for a subdirectory: kde-foo.desktop can be
+// kde/foo.desktop.
+func findDesktopFile(id string) (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	for _, dir := range append([]string{dataHome}, filepath.SplitList(dataDirs)...) {
+		apps := filepath.Join(dir, "applications")
+		if _, err := os.Stat(filepath.Join(apps, id)); err == nil {
+			return filepath.Join(apps, id), nil
+		}
+		found := ""
+		_ = filepath.WalkDir(apps, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if rel, err := filepath.Rel(apps, p); err == nil && strings.ReplaceAll(rel, "/", "-") == id {
+				found = p
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("desktop file %s not found", id)
+}
+
+// desktopExec returns the Exec key of the [Desktop Entry] group.
+func desktopExec(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	inEntry := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && inEntry && strings.TrimSpace(key) == "Exec" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no Exec line")
+}
+
+// expandExec splits a desktop entry Exec value into arguments and puts
+// path in place of the file field code (%f, %F, %u or %U), appending it
+// if there is none. Other field codes are dropped.
+func expandExec(line, path string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case c == '"':
+			quoted, inArg = !quoted, true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in Exec=%s", line)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+
+	var expanded []string
+	placed := false
+	for _, arg := range args {
+		switch arg {
+		case "%f", "%F", "%u", "%U":
+			if !placed {
+				expanded = append(expanded, path)
+				placed = true
+			}
+			continue
+		case "%i", "%c", "%k", "%d", "%D", "%n", "%N", "%v", "%m":
+			continue
+		}
+		expanded = append(expanded, strings.ReplaceAll(arg, "%%", "%"))
+	}
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("empty Exec=%s", line)
+	}
+	if !placed {
+		expanded = append(expanded, path)
+	}
+	return expanded, nil
+}
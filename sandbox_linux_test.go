@@ -0,0 +1,88 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandExec(t *testing.T) {
+	tests := []struct {
+		exec string
+		want []string
+	}{
+		{"evince %U", []string{"evince", "/tmp/a b.pdf"}},
+		{"libreoffice --writer %F --norestore", []string{"libreoffice", "--writer", "/tmp/a b.pdf", "--norestore"}},
+		{`"/opt/My App/bin/app" --name "x \"y\"" %i %c %k`, []string{"/opt/My App/bin/app", "--name", `x "y"`, "/tmp/a b.pdf"}},
+		{"gimp-2.10 --progress=100%%", []string{"gimp-2.10", "--progress=100%", "/tmp/a b.pdf"}},
+	}
+	for _, tt := range tests {
+		got, err := expandExec(tt.exec, "/tmp/a b.pdf")
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("expandExec(%q) = %q, %v, want %q", tt.exec, got, err, tt.want)
+		}
+	}
+	if _, err := expandExec(`app "unterminated`, "/x"); err == nil {
+		t.Error("expandExec accepted an unterminated quote")
+	}
+}
+
+func TestDesktopExec(t *testing.T) {
+	entry := "[Desktop Entry]\nName=Viewer\nExec=viewer %f\n\n[Desktop Action new]\nExec=viewer --new\n"
+	if got, err := desktopExec(strings.NewReader(entry)); err != nil || got != "viewer %f" {
+		t.Errorf("desktopExec = %q, %v", got, err)
+	}
+	if _, err := desktopExec(strings.NewReader("[Desktop Action x]\nExec=x\n")); err == nil {
+		t.Error("desktopExec took Exec from an action group")
+	}
+}
+
+func TestFindDesktopFile(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("XDG_DATA_DIRS", filepath.Join(data, "none"))
+	path := filepath.Join(data, "applications", "kde", "okular.desktop")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("[Desktop Entry]\nExec=okular %U\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := findDesktopFile("kde-okular.desktop"); err != nil || got != path {
+		t.Errorf("findDesktopFile = %q, %v, want %q", got, err, path)
+	}
+	if _, err := findDesktopFile("missing.desktop"); err == nil {
+		t.Error("findDesktopFile found a missing file")
+	}
+}
+
+func TestBwrapArgs(t *testing.T) {
+	env := map[string]string{"HOME": "/home/me", "XDG_RUNTIME_DIR": "/run/user/1000", "WAYLAND_DISPLAY": "wayland-0"}
+	args := bwrapArgs("/home/me/Downloads/a.pdf", []string{"evince", "/home/me/Downloads/a.pdf"}, func(k string) string { return env[k] })
+	joined := strings.Join(args, " ")
+	for _, want := range []string{
+		"--unshare-all",
+		"--tmpfs /tmp",
+		"--tmpfs /home/me",
+		"--ro-bind-try /run/user/1000/wayland-0 /run/user/1000/wayland-0",
+		"--ro-bind /home/me/Downloads/a.pdf /home/me/Downloads/a.pdf -- evince /home/me/Downloads/a.pdf",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("bwrap args lack %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "--share-net") || strings.Contains(joined, "--bind ") {
+		t.Errorf("bwrap args share the network or bind writable:\n%s", joined)
+	}
+}
+
+func TestSandboxRule(t *testing.T) {
+	rule, err := ParseRule(`sandbox if origin != ""`)
+	if err != nil || rule.Action != ActionSandbox {
+		t.Fatalf("ParseRule = %v, %v", rule.Action, err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors for URLs rejected by the sanitization rules. They are wrapped in a
+// *URLError; use errors.Is to test for them.
+var (
+	ErrTooLong        = errors.New("URL too long")
+	ErrControlChar    = errors.New("control character")
+	ErrNullByte       = errors.New("NUL byte")
+	ErrInvalidUTF8    = errors.New("invalid UTF-8")
+	ErrDoubleEncoding = errors.New("double percent-encoding")
+	ErrBackslash      = errors.New("backslash in path")
+	ErrTraversal      = errors.New("path traversal")
+)
+
+const (
+	// maxURLLength bounds the raw URL, before decoding.
+	maxURLLength = 8192
+	// maxPathLength bounds the decoded path (PATH_MAX on Linux).
+	maxPathLength = 4096
+)
+
+// URLError describes why a URL was rejected.
+type URLError struct {
+	Err    error // one of the Err* sentinels
+	Offset int   // byte offset of the offending input, -1 if not applicable
+	Detail string
+}
+
+func (e *URLError) Error() string {
+	msg := e.Err.Error()
+	if e.Offset >= 0 {
+		msg += fmt.Sprintf(" at offset %d", e.Offset)
+	}
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
+// exitCodes maps sanitization errors to process exit codes, so that scripts
+// can tell rejections apart. Other errors exit with 1.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrTooLong, 10},
+	{ErrControlChar, 11},
+	{ErrNullByte, 12},
+	{ErrInvalidUTF8, 13},
+	{ErrDoubleEncoding, 14},
+	{ErrBackslash, 15},
+	{ErrTraversal, 16},
+}
+
+// exitCode returns the process exit code for err.
+func exitCode(err error) int {
+	for _, ec := range exitCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code
+		}
+	}
+	return 1
+}
+
+// checkRawURL applies the rules for the URL as received, before parsing:
+//   - at most maxURLLength bytes (ErrTooLong)
+//   - no ASCII control characters or DEL; browsers percent-encode these, so
+//     a raw one means the URL was built by hand (ErrControlChar)
+func checkRawURL(raw string) error {
+	if len(raw) > maxURLLength {
+		return &URLError{Err: ErrTooLong, Offset: -1, Detail: fmt.Sprintf("%d bytes, limit %d", len(raw), maxURLLength)}
+	}
+	for i := 0; i < len(raw); i++ {
+		if c := raw[i]; c < 0x20 || c == 0x7f {
+			return &URLError{Err: ErrControlChar, Offset: i, Detail: fmt.Sprintf("U+%04X", c)}
+		}
+	}
+	return nil
+}
+
+// sanitizePath applies the rules for the percent-decoded path and returns it
+// normalized:
+//   - at most maxPathLength bytes (ErrTooLong)
+//   - valid UTF-8 (ErrInvalidUTF8)
+//   - no NUL (ErrNullByte) and no C0/C1 control characters or DEL (ErrControlChar)
+//   - no percent-escapes left after decoding once that would decode to a
+//     separator, a control character or a ".." segment (ErrDoubleEncoding);
+//     others are literal, as in a file saved as "Report%20Q3.pdf"
+//   - backslashes become slashes on Windows and are rejected elsewhere (ErrBackslash)
+//   - no ".." segments (ErrTraversal)
+func sanitizePath(path string) (string, error) {
+	if len(path) > maxPathLength {
+		return "", &URLError{Err: ErrTooLong, Offset: -1, Detail: fmt.Sprintf("path is %d bytes, limit %d", len(path), maxPathLength)}
+	}
+	if !utf8.ValidString(path) {
+		return "", &URLError{Err: ErrInvalidUTF8, Offset: invalidUTF8Offset(path)}
+	}
+	for i, r := range path {
+		switch {
+		case r == 0:
+			return "", &URLError{Err: ErrNullByte, Offset: i}
+		case r < 0x20 || (r >= 0x7f && r <= 0x9f):
+			return "", &URLError{Err: ErrControlChar, Offset: i, Detail: fmt.Sprintf("U+%04X", r)}
+		}
+	}
+	if i := percentEscape(path); i >= 0 && unsafeEscapes(path) {
+		return "", &URLError{Err: ErrDoubleEncoding, Offset: i, Detail: path[i : i+3]}
+	}
+
+	if i := strings.IndexByte(path, '\\'); i >= 0 {
+		if runtime.GOOS != "windows" {
+			return "", &URLError{Err: ErrBackslash, Offset: i}
+		}
+		path = strings.ReplaceAll(path, `\`, "/")
+	}
+
+	offset := 0
+	for _, seg := range strings.Split(path, "/") {
+		if seg == ".." {
+			return "", &URLError{Err: ErrTraversal, Offset: offset}
+		}
+		offset += len(seg) + 1
+	}
+	return path, nil
+}
+
+// unsafeEscapes reports whether decoding path a second time would add a
+// separator, a control character or a ".." segment, i.e. whether a program
+// that decodes twice would see a different path than ope.
+func unsafeEscapes(path string) bool {
+	again, err := url.PathUnescape(path)
+	if err != nil {
+		return false
+	}
+	if strings.Count(again, "/") != strings.Count(path, "/") || strings.Count(again, `\`) != strings.Count(path, `\`) {
+		return true
+	}
+	for _, r := range again {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			return true
+		}
+	}
+	return slices.Contains(strings.Split(strings.ReplaceAll(again, `\`, "/"), "/"), "..")
+}
+
+// percentEscape returns the offset of the first %XX escape in s, or -1.
+func percentEscape(s string) int {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '%' && isHex(s[i+1]) && isHex(s[i+2]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func invalidUTF8Offset(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseOpeURLSanitize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"raw newline", "ope:///tmp/a\nb", ErrControlChar},
+		{"encoded newline", "ope:///tmp/a%0Ab", ErrControlChar},
+		{"encoded C1 control", "ope:///tmp/a%C2%85b", ErrControlChar},
+		{"encoded NUL", "ope:///tmp/a%00.txt", ErrNullByte},
+		{"invalid UTF-8", "ope:///tmp/%FF", ErrInvalidUTF8},
+		{"double encoding", "ope:///tmp/%252e%252e/etc", ErrDoubleEncoding},
+		{"traversal", "ope:///tmp/../etc/passwd", ErrTraversal},
+		{"encoded traversal", "ope:///tmp/%2E%2E/etc/passwd", ErrTraversal},
+		{"too long", "ope:///" + strings.Repeat("a", maxURLLength), ErrTooLong},
+		{"path too long", "ope:///" + strings.Repeat("a/", maxPathLength/2+1), ErrTooLong},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name    string
+			input   string
+			wantErr error
+		}{"backslash", `ope:///tmp/a%5C..%5Cb`, ErrBackslash})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpeURL(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseOpeURL(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			var urlErr *URLError
+			if !errors.As(err, &urlErr) {
+				t.Errorf("error %T is not a *URLError", err)
+			}
+			if exitCode(err) == 1 {
+				t.Errorf("exitCode(%v) = 1, want a specific code", err)
+			}
+		})
+	}
+}
+
+func TestParseOpeURLLiteralPercent(t *testing.T) {
+	// A browser saved the file under its still-encoded name.
+	got, err := ParseOpeURL("ope:///tmp/Report%2520Q3.pdf")
+	if err != nil {
+		t.Fatalf("ParseOpeURL: %v", err)
+	}
+	if got != "/tmp/Report%20Q3.pdf" {
+		t.Errorf("got %q", got)
+	}
+
+	for _, input := range []string{"ope:///tmp/a%252Fb", "ope:///tmp/a%250Ab", "ope:///tmp/%252E./etc", "ope:///tmp/a%255Cb"} {
+		if _, err := ParseOpeURL(input); !errors.Is(err, ErrDoubleEncoding) {
+			t.Errorf("ParseOpeURL(%q) error = %v, want %v", input, err, ErrDoubleEncoding)
+		}
+	}
+}
+
+func TestParseOpeURLAllowsDotsInNames(t *testing.T) {
+	got, err := ParseOpeURL("ope:///tmp/dots..and.single.dot/./x")
+	if err != nil {
+		t.Fatalf("ParseOpeURL: %v", err)
+	}
+	if got != "/tmp/dots..and.single.dot/./x" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scanner runs a local malware scanner on files before they are opened.
+//
+// The command must follow the exit code contract that clamscan and
+// clamdscan use: 0 means clean, 1 means infected and anything else is an
+// error. Its first line of output is shown when a file is blocked.
+type Scanner struct {
+	// Command is the program and its arguments. "{}" is replaced by the
+	// path; without it, the path is appended.
+	Command []string `yaml:"command"`
+	// Patterns are blocked/allowed style entries for files to scan even
+	// when the policy allows them. Files that would ask are always scanned.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Timeout bounds a scan; the default is defaultScanTimeout.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// OnError is "closed" (block, the default) or "open" (go on without a
+	// scan) for scanner failures. OnTimeout and OnMissing override it for a
+	// scan that times out and for a scanner that isn't installed.
+	OnError   string `yaml:"on_error,omitempty"`
+	OnTimeout string `yaml:"on_timeout,omitempty"`
+	OnMissing string `yaml:"on_missing,omitempty"`
+}
+
+const (
+	failClosed = "closed"
+	failOpen   = "open"
+
+	defaultScanTimeout = time.Minute
+)
+
+// Scan errors, for a scanner that didn't produce a result.
+var (
+	errScanTimeout = errors.New("scanner timed out")
+	errScanMissing = errors.New("scanner not installed")
+)
+
+// check rejects scanner settings that can't work.
+func (s *Scanner) check() error {
+	if len(s.Command) == 0 {
+		return fmt.Errorf("scanner: command is empty")
+	}
+	for _, mode := range []string{s.OnError, s.OnTimeout, s.OnMissing} {
+		if mode != "" && mode != failClosed && mode != failOpen {
+			return fmt.Errorf("scanner: %q is not %q or %q", mode, failClosed, failOpen)
+		}
+	}
+	return nil
+}
+
+// args returns the command line that scans path.
+func (s *Scanner) args(path string) []string {
+	args := make([]string, 0, len(s.Command)+1)
+	replaced := false
+	for _, arg := range s.Command {
+		if strings.Contains(arg, "{}") {
+			arg = strings.ReplaceAll(arg, "{}", path)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	return args
+}
+
+// wants reports whether a file with verdict v is to be scanned.
+func (s *Scanner) wants(v Verdict) bool {
+	if !v.Action.opens() {
+		return false
+	}
+	if v.Action == ActionAsk || v.Action == ActionAskAlways {
+		return true
+	}
+	f := candidate{path: v.Target, origin: v.Origin, isDir: isDirFunc(v.Target)}
+	pattern, _ := matchList(s.Patterns, "", f)
+	return pattern != ""
+}
+
+// scan runs the scanner on path. It returns whether the file is infected
+// and the scanner's message, or an error if there is no result.
+func (s *Scanner) scan(path string) (infected bool, message string, err error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := s.args(path)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	// Don't wait for children of a killed scanner that keep its output open.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	message = firstLine(string(out))
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return false, "", fmt.Errorf("%w after %v", errScanTimeout, timeout)
+	case errors.Is(err, exec.ErrNotFound):
+		return false, "", fmt.Errorf("%w: %s", errScanMissing, args[0])
+	case err == nil:
+		return false, message, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return true, message, nil
+	case errors.As(err, &exitErr):
+		if message == "" {
+			message = err.Error()
+		}
+		return false, "", fmt.Errorf("scanner failed (exit code %d): %s", exitErr.ExitCode(), message)
+	default:
+		return false, "", fmt.Errorf("scanner failed: %w", err)
+	}
+}
+
+// failMode returns how to handle a scan that failed with err.
+func (s *Scanner) failMode(err error) string {
+	mode := s.OnError
+	switch {
+	case errors.Is(err, errScanTimeout) && s.OnTimeout != "":
+		mode = s.OnTimeout
+	case errors.Is(err, errScanMissing) && s.OnMissing != "":
+		mode = s.OnMissing
+	}
+	if mode == "" {
+		mode = failClosed
+	}
+	return mode
+}
+
+// scanPath returns the path to hand the scanner for the pinned file, so
+// that what is scanned is what gets opened even if the target is replaced
+// in the meantime: the descriptor's path where there is one, a snapshot
+// otherwise. Call done once the scan is over. Without a pin, and for
+// directories, it is the target itself.
+func scanPath(target string, pin *pinnedFile) (path string, done func(), err error) {
+	if pin == nil || !pin.info.Mode().IsRegular() {
+		return target, func() {}, nil
+	}
+	if path := pin.fdPath(); path != "" {
+		return path, func() {}, nil
+	}
+	snap, err := takeSnapshot(target, pin)
+	if err != nil {
+		return "", nil, err
+	}
+	return snap, func() { _ = removeSnapshot(filepath.Dir(snap)) }, nil
+}
+
+// apply scans the target of v, through pin if it is not nil, if the
+// scanner wants it and returns the verdict adjusted to the result: infected
+// files are blocked with the scanner's message, and failed scans block or
+// ask with a warning depending on the fail mode.
+func (s *Scanner) apply(v Verdict, pin *pinnedFile) Verdict {
+	if !s.wants(v) {
+		return v
+	}
+	path, done, err := scanPath(v.Target, pin)
+	var infected bool
+	var message string
+	if err == nil {
+		infected, message, err = s.scan(path)
+		done()
+		message = strings.ReplaceAll(message, path, v.Target)
+	}
+	switch {
+	case err != nil && s.failMode(err) == failOpen:
+		// Like a deceptive name, a file that wasn't scanned never opens
+		// without the dialog.
+		v.Warnings = append(v.Warnings, "not scanned: "+err.Error())
+		if v.Action != ActionAsk && v.Action != ActionAskAlways {
+			v.Then, v.Action = v.Action, ActionAsk
+			v.Rule += " (asking: not scanned)"
+		}
+	case err != nil:
+		v.Action, v.Rule = ActionBlock, err.Error()
+	case infected:
+		if message == "" {
+			message = "infected"
+		}
+		v.Action, v.Rule = ActionBlock, "scanner: "+message
+	}
+	return v
+}
+
+// firstLine returns the first non-empty line of s, shortened for dialogs.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if r := []rune(line); len(r) > 200 {
+				line = string(r[:200]) + "…"
+			}
+			return line
+		}
+	}
+	return ""
+}
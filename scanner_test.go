@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeScanner writes a shell script that follows the clamscan exit code
+// contract: files containing "EICAR" are infected, "ERROR" fails, "SLOW"
+// hangs.
+func fakeScanner(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	script := filepath.Join(t.TempDir(), "scan.sh")
+	body := `#!/bin/sh
+if grep -q EICAR "$1"; then echo "$1: Eicar-Signature FOUND"; exit 1; fi
+if grep -q ERROR "$1"; then echo "cannot read database" >&2; exit 2; fi
+if grep -q SLOW "$1"; then exec sleep 5; fi
+echo "$1: OK"
+`
+	if err := os.WriteFile(script, []byte(body), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestScannerApply(t *testing.T) {
+	script := fakeScanner(t)
+	dir := t.TempDir()
+	files := map[string]string{"clean.pdf": "hello", "eicar.pdf": "EICAR", "broken.pdf": "ERROR", "slow.pdf": "SLOW"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Scanner{Command: []string{script, "{}"}, Timeout: 200 * time.Millisecond}
+	ask := func(name string) Verdict {
+		return Verdict{Action: ActionAsk, Rule: "default: unknown file", Target: filepath.Join(dir, name)}
+	}
+
+	if v := s.apply(ask("clean.pdf"), nil); v.Action != ActionAsk || len(v.Warnings) != 0 {
+		t.Errorf("clean: %v %q %v", v.Action, v.Rule, v.Warnings)
+	}
+	if v := s.apply(ask("eicar.pdf"), nil); v.Action != ActionBlock || !strings.HasSuffix(v.Rule, "Eicar-Signature FOUND") {
+		t.Errorf("infected: %v %q", v.Action, v.Rule)
+	}
+	if v := s.apply(ask("broken.pdf"), nil); v.Action != ActionBlock || !strings.Contains(v.Rule, "exit code 2") {
+		t.Errorf("error, fail closed: %v %q", v.Action, v.Rule)
+	}
+	if v := s.apply(ask("slow.pdf"), nil); v.Action != ActionBlock || !strings.Contains(v.Rule, "timed out") {
+		t.Errorf("timeout, fail closed: %v %q", v.Action, v.Rule)
+	}
+
+	s.OnTimeout = failOpen
+	if v := s.apply(ask("slow.pdf"), nil); v.Action != ActionAsk || len(v.Warnings) != 1 {
+		t.Errorf("timeout, fail open: %v %q %v", v.Action, v.Rule, v.Warnings)
+	}
+	if v := s.apply(ask("broken.pdf"), nil); v.Action != ActionBlock {
+		t.Errorf("error with only on_timeout open: %v %q", v.Action, v.Rule)
+	}
+
+	missing := &Scanner{Command: []string{"ope-no-such-scanner"}}
+	if v := missing.apply(ask("clean.pdf"), nil); v.Action != ActionBlock || !strings.Contains(v.Rule, "not installed") {
+		t.Errorf("missing, fail closed: %v %q", v.Action, v.Rule)
+	}
+	missing.OnMissing = failOpen
+	if v := missing.apply(ask("clean.pdf"), nil); v.Action != ActionAsk {
+		t.Errorf("missing, fail open: %v %q", v.Action, v.Rule)
+	}
+
+	// A file that would open without asking asks when it wasn't scanned.
+	missing.Patterns = []string{"*.pdf"}
+	sandbox := Verdict{Action: ActionSandbox, Rule: "rule: sandbox if true", Target: filepath.Join(dir, "clean.pdf")}
+	if v := missing.apply(sandbox, nil); v.Action != ActionAsk || v.Then != ActionSandbox || len(v.Warnings) != 1 {
+		t.Errorf("missing, fail open, sandbox: %v then %v %q %v", v.Action, v.Then, v.Rule, v.Warnings)
+	}
+}
+
+func TestScannerApplyPinned(t *testing.T) {
+	script := fakeScanner(t)
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	dir := t.TempDir()
+	s := &Scanner{Command: []string{script}}
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pin := func(path string) *pinnedFile {
+		t.Helper()
+		p, err := pinFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { p.Close() })
+		return p
+	}
+
+	// The scanner's message names the target, not the path it was given.
+	eicar := write("eicar.pdf", "EICAR")
+	v := s.apply(Verdict{Action: ActionAsk, Target: eicar}, pin(eicar))
+	if v.Action != ActionBlock || v.Rule != "scanner: "+eicar+": Eicar-Signature FOUND" {
+		t.Errorf("infected: %v %q", v.Action, v.Rule)
+	}
+
+	// What is scanned is the pinned file, even once the path is replaced.
+	clean := write("clean.pdf", "hello")
+	cleanPin := pin(clean)
+	if err := os.Rename(write("swap.pdf", "EICAR"), clean); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.apply(Verdict{Action: ActionAsk, Target: clean}, cleanPin); v.Action != ActionAsk {
+		t.Errorf("swapped after pinning: %v %q", v.Action, v.Rule)
+	}
+}
+
+func TestScannerWants(t *testing.T) {
+	s := &Scanner{Command: []string{"clamdscan"}, Patterns: []string{"*.pdf"}}
+	tests := []struct {
+		v    Verdict
+		want bool
+	}{
+		{Verdict{Action: ActionAsk, Target: "/tmp/x.bin"}, true},
+		{Verdict{Action: ActionAllow, Target: "/tmp/x.pdf"}, true},
+		{Verdict{Action: ActionAllow, Target: "/tmp/x.txt"}, false},
+		{Verdict{Action: ActionBlock, Target: "/tmp/x.pdf"}, false},
+	}
+	for _, tt := range tests {
+		if got := s.wants(tt.v); got != tt.want {
+			t.Errorf("wants(%v %s) = %v, want %v", tt.v.Action, tt.v.Target, got, tt.want)
+		}
+	}
+
+	if got := s.args("/tmp/x.pdf"); len(got) != 2 || got[1] != "/tmp/x.pdf" {
+		t.Errorf("args = %q", got)
+	}
+	if err := (&Scanner{Command: []string{"x"}, OnError: "maybe"}).check(); err == nil {
+		t.Error("check accepted on_error: maybe")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// modeSnapshot is the ope:// URL mode parameter that opens a snapshot;
+// e.g. ope:///srv/share/budget.xlsx?mode=snapshot.
+const modeSnapshot = "snapshot"
+
+// defaultSnapshotRetention is how long snapshots are kept unless the
+// snapshot_retention setting says otherwise.
+const defaultSnapshotRetention = 24 * time.Hour
+
+// snapshotPrefix starts the name of every snapshot directory, so that
+// cleanup never touches anything else.
+const snapshotPrefix = "snap-"
+
+// maxRuntimeSnapshotSize is the largest file snapshotted to runtime
+// storage, which is usually in memory.
+const maxRuntimeSnapshotSize = 64 << 20
+
+// runtimeSnapshotRetention caps how long snapshots in runtime storage are
+// kept, whatever snapshot_retention says.
+const runtimeSnapshotRetention = time.Hour
+
+// SnapshotRoot returns the private directory snapshots are kept in:
+// ope/snapshots in the user cache directory. That is on disk, and usually
+// on the same filesystem as the user's files, so reflinks work and large
+// files don't take up memory.
+func SnapshotRoot() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ope", "snapshots"), nil
+}
+
+// runtimeSnapshotRoot returns $XDG_RUNTIME_DIR/ope/snapshots, where
+// snapshots go if SnapshotRoot can't be used, or "" if there is no runtime
+// directory.
+func runtimeSnapshotRoot() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "ope", "snapshots")
+	}
+	return ""
+}
+
+// newSnapshotDir creates a directory for a snapshot of size bytes under
+// SnapshotRoot, or under runtimeSnapshotRoot if that fails and the file is
+// no larger than maxRuntimeSnapshotSize.
+func newSnapshotDir(size int64) (string, error) {
+	mkdir := func(root string) (string, error) {
+		if err := os.MkdirAll(root, 0o700); err != nil {
+			return "", err
+		}
+		return os.MkdirTemp(root, snapshotPrefix+"*")
+	}
+	root, err := SnapshotRoot()
+	if err == nil {
+		var dir string
+		if dir, err = mkdir(root); err == nil {
+			return dir, nil
+		}
+	}
+	if fallback := runtimeSnapshotRoot(); fallback != "" && size <= maxRuntimeSnapshotSize {
+		return mkdir(fallback)
+	}
+	return "", err
+}
+
+// takeSnapshot copies the pinned file into a new directory under
+// SnapshotRoot (see newSnapshotDir), as a reflink where the filesystem
+// supports it, and makes the copy and its directory read-only so that
+// applications can't save over it. It returns the path of the copy, which
+// keeps the file's name.
+func takeSnapshot(target string, pin *pinnedFile) (string, error) {
+	if !pin.info.Mode().IsRegular() {
+		return "", fmt.Errorf("snapshots only work for files: %s", target)
+	}
+	dir, err := newSnapshotDir(pin.info.Size())
+	if err != nil {
+		return "", fmt.Errorf("snapshot of %s: %w", target, err)
+	}
+
+	path := filepath.Join(dir, filepath.Base(target))
+	if err := copySnapshot(path, pin); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("snapshot of %s: %w", target, err)
+	}
+	if err := os.Chmod(path, 0o444); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, 0o555); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// copySnapshot writes the pinned content to path, cloning it if possible.
+func copySnapshot(path string, pin *pinnedFile) error {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := reflink(dst, pin.file); err != nil {
+		_, err = io.Copy(dst, io.NewSectionReader(pin.file, 0, pin.info.Size()))
+		if err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, pin.info.ModTime(), pin.info.ModTime())
+}
+
+// cleanSnapshots removes snapshots older than retention, and those in
+// runtime storage after runtimeSnapshotRetention at the latest.
+func cleanSnapshots(retention time.Duration) error {
+	if retention <= 0 {
+		retention = defaultSnapshotRetention
+	}
+	root, err := SnapshotRoot()
+	if err != nil {
+		return err
+	}
+	errs := []error{cleanSnapshotRoot(root, retention)}
+	if fallback := runtimeSnapshotRoot(); fallback != "" {
+		errs = append(errs, cleanSnapshotRoot(fallback, min(retention, runtimeSnapshotRetention)))
+	}
+	return errors.Join(errs...)
+}
+
+// cleanSnapshotRoot removes the snapshots in root older than retention.
+func cleanSnapshotRoot(root string, retention time.Duration) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), snapshotPrefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < retention {
+			continue
+		}
+		errs = append(errs, removeSnapshot(filepath.Join(root, e.Name())))
+	}
+	return errors.Join(errs...)
+}
+
+// removeSnapshot deletes a snapshot directory, which takeSnapshot made
+// read-only.
+func removeSnapshot(dir string) error {
+	_ = os.Chmod(dir, 0o700)
+	return os.RemoveAll(dir)
+}
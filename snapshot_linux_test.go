@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTakeSnapshotRuntimeFallback(t *testing.T) {
+	// A file where the cache directory should be makes it unusable.
+	cache := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(cache, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	pin := func(size int64) (string, *pinnedFile) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "budget.xlsx")
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, size); err != nil {
+			t.Fatal(err)
+		}
+		p, err := pinFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { p.Close() })
+		return path, p
+	}
+
+	src, small := pin(1 << 10)
+	snap, err := takeSnapshot(src, small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isUnder(snap, runtimeSnapshotRoot()) {
+		t.Errorf("snapshot at %s, want it under %s", snap, runtimeSnapshotRoot())
+	}
+
+	// Large files don't go to runtime storage, which is usually in memory.
+	largeSrc, large := pin(maxRuntimeSnapshotSize + 1)
+	if snap, err := takeSnapshot(largeSrc, large); err == nil {
+		t.Errorf("large file snapshotted to %s", snap)
+	}
+
+	// Runtime snapshots are removed after an hour, whatever the retention.
+	old := time.Now().Add(-2 * runtimeSnapshotRetention)
+	if err := os.Chtimes(filepath.Dir(snap), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// The error is about the unusable cache directory.
+	_ = cleanSnapshots(7 * 24 * time.Hour)
+	if _, err := os.Stat(filepath.Dir(snap)); !os.IsNotExist(err) {
+		t.Errorf("expired runtime snapshot kept: %v", err)
+	}
+}
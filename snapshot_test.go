@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+	src := filepath.Join(t.TempDir(), "budget.xlsx")
+	if err := os.WriteFile(src, []byte("master copy"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pin, err := pinFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Close()
+
+	snap, err := takeSnapshot(src, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := SnapshotRoot()
+	if filepath.Base(snap) != "budget.xlsx" || !isUnder(snap, root) {
+		t.Errorf("snapshot at %s, want budget.xlsx under %s", snap, root)
+	}
+	if data, err := os.ReadFile(snap); err != nil || string(data) != "master copy" {
+		t.Errorf("snapshot content = %q, %v", data, err)
+	}
+	info, err := os.Stat(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0o222 != 0 {
+		t.Errorf("snapshot mode = %v, want read-only", info.Mode())
+	}
+	if !info.ModTime().Equal(pin.info.ModTime()) {
+		t.Errorf("snapshot mtime = %v, want %v", info.ModTime(), pin.info.ModTime())
+	}
+	if runtime.GOOS != "windows" {
+		dir, _ := os.Stat(filepath.Dir(snap))
+		if dir.Mode().Perm()&0o222 != 0 {
+			t.Errorf("snapshot dir mode = %v, want read-only", dir.Mode())
+		}
+	}
+
+	dirPin, err := pinFile(filepath.Dir(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dirPin.Close()
+	if _, err := takeSnapshot(filepath.Dir(src), dirPin); err == nil {
+		t.Error("takeSnapshot copied a directory")
+	}
+
+	// Fresh snapshots survive cleanup, expired ones don't.
+	if err := cleanSnapshots(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snap); err != nil {
+		t.Errorf("fresh snapshot removed: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Dir(snap), old, old); err != nil {
+		t.Fatal(err)
+	}
+	keep := filepath.Join(root, "not-a-snapshot")
+	if err := os.Mkdir(keep, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keep, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanSnapshots(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(snap)); !os.IsNotExist(err) {
+		t.Errorf("expired snapshot kept: %v", err)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("cleanup removed %s: %v", keep, err)
+	}
+}
+
+func TestURLMode(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"ope:///srv/budget.xlsx", "", true},
+		{"ope:///srv/budget.xlsx?mode=snapshot", "snapshot", true},
+		{"ope:srv/budget.xlsx?mode=snapshot", "snapshot", true},
+		{"ope:///srv/budget.xlsx?mode=edit", "", false},
+	}
+	for _, tt := range tests {
+		got, err := URLMode(tt.url)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("URLMode(%q) = %q, %v", tt.url, got, err)
+		}
+	}
+	if path, err := ParseOpeURL("ope:///srv/budget.xlsx?mode=snapshot"); err != nil || path != "/srv/budget.xlsx" {
+		t.Errorf("ParseOpeURL with mode = %q, %v", path, err)
+	}
+	if rule, err := ParseRule(`snapshot if path under "/srv/evidence"`); err != nil || rule.Action != ActionSnapshot {
+		t.Errorf("ParseRule(snapshot) = %v, %v", rule.Action, err)
+	}
+}
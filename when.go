@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WhenBlock holds settings that only apply on matching machines:
+//
+//	when:
+//	  - hostname: "build-vm-*"
+//	    set:
+//	      silent: true
+//	      rules:
+//	        - block if not path under "/srv"
+//
+// All conditions given must match. Settings in set replace the config's,
+// lists are appended to it.
+type WhenBlock struct {
+	// Hostname is a glob matched against the host name.
+	Hostname string `yaml:"hostname,omitempty"`
+	// OS is matched against runtime.GOOS: linux, darwin or windows.
+	OS string `yaml:"os,omitempty"`
+	// Desktop is a glob matched against each entry of XDG_CURRENT_DESKTOP.
+	Desktop string `yaml:"desktop,omitempty"`
+	// Env maps variable names to globs their value must match. The
+	// variable must be set.
+	Env map[string]string `yaml:"env,omitempty"`
+	Set yaml.Node         `yaml:"set"`
+}
+
+// machine describes the host that when blocks are matched against.
+type machine struct {
+	hostname string
+	goos     string
+	desktops []string
+	getenv   func(string) (string, bool)
+}
+
+func currentMachine() machine {
+	hostname, _ := os.Hostname()
+	var desktops []string
+	if d := os.Getenv("XDG_CURRENT_DESKTOP"); d != "" {
+		desktops = strings.Split(d, ":")
+	}
+	return machine{
+		hostname: hostname,
+		goos:     runtime.GOOS,
+		desktops: desktops,
+		getenv:   os.LookupEnv,
+	}
+}
+
+// matches reports whether every condition of the block holds on m.
+func (w *WhenBlock) matches(m machine) bool {
+	if w.Hostname != "" && !globFold(w.Hostname, m.hostname) {
+		return false
+	}
+	if w.OS != "" && !strings.EqualFold(w.OS, m.goos) {
+		return false
+	}
+	if w.Desktop != "" {
+		found := false
+		for _, d := range m.desktops {
+			found = found || globFold(w.Desktop, d)
+		}
+		if !found {
+			return false
+		}
+	}
+	for name, pattern := range w.Env {
+		value, ok := m.getenv(name)
+		if !ok {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func globFold(pattern, s string) bool {
+	matched, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return matched
+}
+
+// applyWhen overlays the set of every when block that matches m, in order.
+func (c *Config) applyWhen(m machine) error {
+	for i := range c.When {
+		if c.When[i].matches(m) {
+			if err := c.overlay(&c.When[i].Set); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyWhen(t *testing.T) {
+	data := `
+blocked: ["*.exe"]
+silent: false
+when:
+  - hostname: "build-vm-*"
+    set:
+      silent: true
+      blocked: ["*.sh"]
+      rules:
+        - block if not path under "/srv"
+  - os: linux
+    desktop: gnome
+    set:
+      allowed: ["*.pdf"]
+  - env:
+      CI: "true"
+    set:
+      allowed: ["*.log"]
+`
+	env := map[string]string{"CI": "true"}
+	m := machine{
+		hostname: "Build-VM-07",
+		goos:     "linux",
+		desktops: []string{"ubuntu", "GNOME"},
+		getenv: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.applyWhen(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.Silent {
+		t.Error("silent not applied")
+	}
+	if len(cfg.Blocked) != 2 || cfg.Blocked[0] != "*.exe" || cfg.Blocked[1] != "*.sh" {
+		t.Errorf("Blocked = %v, want [*.exe *.sh]", cfg.Blocked)
+	}
+	if len(cfg.Rules) != 1 {
+		t.Errorf("Rules = %v, want one rule", cfg.Rules)
+	}
+	if len(cfg.Allowed) != 2 {
+		t.Errorf("Allowed = %v, want [*.pdf *.log]", cfg.Allowed)
+	}
+	if got := cfg.CheckSecurity("/home/me/report.txt"); got.Action != ActionBlock {
+		t.Errorf("path outside /srv: got %v, want ActionBlock", got.Action)
+	}
+
+	var laptop Config
+	if err := yaml.Unmarshal([]byte(data), &laptop); err != nil {
+		t.Fatal(err)
+	}
+	m.hostname, m.goos, env = "laptop", "darwin", nil
+	if err := laptop.applyWhen(m); err != nil {
+		t.Fatal(err)
+	}
+	if laptop.Silent || len(laptop.Blocked) != 1 || len(laptop.Allowed) != 0 {
+		t.Errorf("no block should match on the laptop: %+v", laptop)
+	}
+}